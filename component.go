@@ -0,0 +1,220 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"andy.dev/srv/log"
+)
+
+const defaultStartTimeout = 30 * time.Second
+
+// ComponentOption configures a component. See [AddComponent].
+type ComponentOption func(c *component) error
+
+type component struct {
+	name         string
+	start        JobFn
+	stop         JobFn
+	dependsOn    []string
+	startTimeout time.Duration
+	location     log.CodeLocation
+	logger       *Logger
+}
+
+// DependsOn declares the components which must be started before this one, and
+// which will only be stopped after it has been.
+func DependsOn(names ...string) ComponentOption {
+	return func(c *component) error {
+		for _, name := range names {
+			if name == "" {
+				return fmt.Errorf("dependency name cannot be empty")
+			}
+			if name == c.name {
+				return fmt.Errorf("component cannot depend on itself")
+			}
+		}
+		c.dependsOn = append(c.dependsOn, names...)
+		return nil
+	}
+}
+
+// StartTimeout sets how long a component may take to start. If its start
+// function takes longer than this, its context will be cancelled, and it will
+// be considered to have failed. Default: 30 seconds
+func StartTimeout(timeout time.Duration) ComponentOption {
+	return func(c *component) error {
+		if timeout <= 0 {
+			return fmt.Errorf("start timeout must be greater than 0")
+		}
+		c.startTimeout = timeout
+		return nil
+	}
+}
+
+// AddComponent adds a component, such as a database pool or a server, which
+// must be started before the service's jobs run and stopped after they have
+// finished. Components are started one at a time by [Serve], after any
+// components they depend on, and are stopped in the reverse order once the
+// shutdown handlers have run and every job has returned. Only components which
+// started successfully are stopped.
+//
+// The start function should return once the component is ready; long-running
+// work belongs in a job. If any component fails to start, no jobs are run and
+// the service shuts down with a failure. A shutdown signal received while
+// components are starting cancels the context of the one being started, and
+// the service shuts down. Either function may be nil.
+//
+// Dependencies may be added in any order, and are checked by [Serve], which
+// will fail if a dependency is missing or there is a cycle.
+func AddComponent(name string, start, stop JobFn, options ...ComponentOption) {
+	std.addComponent(log.Up(1), name, start, stop, options)
+}
+
+// AddComponent adds a component to the service. See [AddComponent].
+func (s *Service) AddComponent(name string, start, stop JobFn, options ...ComponentOption) {
+	s.addComponent(log.Up(1), name, start, stop, options)
+}
+
+func (s *Service) addComponent(caller log.CodeLocation, name string, start, stop JobFn, options []ComponentOption) {
+	if name == "" {
+		s.fatal(caller, "AddComponent(): component name cannot be empty")
+		return
+	}
+	c := &component{
+		name:         name,
+		start:        start,
+		stop:         stop,
+		startTimeout: defaultStartTimeout,
+		location:     caller,
+	}
+	for _, o := range options {
+		if err := o(c); err != nil {
+			s.fatal(caller, "bad component option", err, "component", name)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.served {
+		s.fatal(caller, "components can't be added after Serve()")
+		return
+	}
+	for _, existing := range s.components {
+		if existing.name == name {
+			s.fatal(caller, "AddComponent():", fmt.Errorf("duplicate component name: %s", name))
+			return
+		}
+	}
+	c.logger = s.rootLogger().With("component", name)
+	s.components = append(s.components, c)
+}
+
+// componentOrder returns the components in the order they should be started,
+// such that every component comes after its dependencies. Components without
+// dependencies between them keep the order in which they were added.
+func componentOrder(components []*component) ([]*component, error) {
+	byName := make(map[string]*component, len(components))
+	for _, c := range components {
+		byName[c.name] = c
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(components))
+	order := make([]*component, 0, len(components))
+	var path []string
+	var visit func(c *component) error
+	visit = func(c *component) error {
+		switch state[c.name] {
+		case visited:
+			return nil
+		case visiting:
+			// path holds the chain of components leading back here.
+			for i := range path {
+				if path[i] == c.name {
+					return fmt.Errorf("component dependency cycle: %s", strings.Join(append(path[i:], c.name), " -> "))
+				}
+			}
+		}
+		state[c.name] = visiting
+		path = append(path, c.name)
+		for _, depName := range c.dependsOn {
+			dep, ok := byName[depName]
+			if !ok {
+				return fmt.Errorf("component %s depends on unknown component %s (%s)", c.name, depName, c.location)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[c.name] = visited
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// startComponents starts each component in order, stopping at the first one
+// which fails or when ctx is cancelled. Components which start successfully
+// are recorded so that they can be stopped during shutdown.
+func (s *Service) startComponents(ctx context.Context, order []*component) error {
+	for _, c := range order {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("component startup interrupted: %w", err)
+		}
+		if c.start == nil {
+			s.startedComponents = append(s.startedComponents, c)
+			continue
+		}
+		s.logInfo(noloc, "starting component", "component", c.name)
+		began := time.Now()
+		startCtx, cancel := context.WithTimeout(ctx, c.startTimeout)
+		_, err := runBounded(startCtx, c.start, c.logger)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			s.logInfo(noloc, "component start interrupted", "component", c.name)
+			return fmt.Errorf("component %s start interrupted: %w", c.name, ctx.Err())
+		}
+		if err != nil {
+			s.termLogErr(noloc, "component failed to start", err, "component", c.name, "location", c.location)
+			return fmt.Errorf("component %s failed to start: %w", c.name, err)
+		}
+		s.startedComponents = append(s.startedComponents, c)
+		s.logDebug(noloc, "component started", "component", c.name, "elapsed", time.Since(began))
+	}
+	return nil
+}
+
+// stopComponents stops all started components in the reverse order of their
+// startup. A component which fails to stop does not prevent the rest from
+// being stopped.
+func (s *Service) stopComponents(ctx context.Context) error {
+	var failure error
+	for i := len(s.startedComponents) - 1; i >= 0; i-- {
+		c := s.startedComponents[i]
+		if c.stop == nil {
+			continue
+		}
+		s.logDebug(noloc, "stopping component", "component", c.name)
+		_, err := runBounded(ctx, c.stop, c.logger)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			s.termLogErr(noloc, "component failed to stop", err, "component", c.name)
+			failure = err
+		}
+	}
+	return failure
+}
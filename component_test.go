@@ -0,0 +1,256 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestComponentOrder(t *testing.T) {
+	type comp struct {
+		name      string
+		dependsOn []string
+	}
+	tests := []struct {
+		name       string
+		components []comp
+		want       []string
+		wantErr    string
+	}{
+		{
+			name:       "no dependencies",
+			components: []comp{{"a", nil}, {"b", nil}, {"c", nil}},
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name:       "dependency added later",
+			components: []comp{{"a", []string{"c"}}, {"b", nil}, {"c", nil}},
+			want:       []string{"c", "a", "b"},
+		},
+		{
+			name: "diamond",
+			components: []comp{
+				{"d", []string{"b", "c"}},
+				{"c", []string{"a"}},
+				{"b", []string{"a"}},
+				{"a", nil},
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:       "missing dependency",
+			components: []comp{{"a", nil}, {"b", []string{"a", "x"}}},
+			wantErr:    "component b depends on unknown component x",
+		},
+		{
+			name:       "cycle",
+			components: []comp{{"a", []string{"b"}}, {"b", []string{"c"}}, {"c", []string{"a"}}},
+			wantErr:    "component dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name:       "cycle reached through another component",
+			components: []comp{{"x", []string{"a"}}, {"a", []string{"b"}}, {"b", []string{"a"}}},
+			wantErr:    "component dependency cycle: a -> b -> a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var components []*component
+			for _, c := range tt.components {
+				components = append(components, &component{name: c.name, dependsOn: c.dependsOn})
+			}
+			order, err := componentOrder(components)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range order {
+				got = append(got, c.name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recorder records the start and stop calls made to components.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.calls)
+}
+
+func (r *recorder) component(name string, startErr error) (start, stop JobFn) {
+	start = func(context.Context, *Logger) error {
+		r.record("start " + name)
+		return startErr
+	}
+	stop = func(context.Context, *Logger) error {
+		r.record("stop " + name)
+		return nil
+	}
+	return start, stop
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s := New(ServiceInfo{Name: "test"},
+		WithArgs("--instrumentation-addr=none", "--termination-log=none"),
+		WithLogHandler(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err := s.err(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestComponentStopAfterFailedStart(t *testing.T) {
+	s := newTestService(t)
+	var r recorder
+	s.AddComponent("e", nil, func(context.Context, *Logger) error {
+		r.record("stop e")
+		return nil
+	})
+	start, stop := r.component("a", nil)
+	s.AddComponent("a", start, stop)
+	start, stop = r.component("b", nil)
+	s.AddComponent("b", start, stop, DependsOn("a"))
+	start, stop = r.component("c", errors.New("boom"))
+	s.AddComponent("c", start, stop, DependsOn("b"))
+	start, stop = r.component("d", nil)
+	s.AddComponent("d", start, stop, DependsOn("c"))
+	s.AddJob(func(context.Context, *Logger) error {
+		t.Error("job run after a component failed to start")
+		return nil
+	})
+
+	err := s.Run(context.Background())
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitFailure {
+		t.Errorf("Run() = %v, want exit code %d", err, ExitFailure)
+	}
+	want := []string{"start a", "start b", "start c", "stop b", "stop a", "stop e"}
+	if got := r.get(); !slices.Equal(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+}
+
+func TestComponentStartInterrupted(t *testing.T) {
+	s := newTestService(t)
+	var r recorder
+	start, stop := r.component("a", nil)
+	s.AddComponent("a", start, stop)
+	starting := make(chan struct{})
+	s.AddComponent("slow", func(ctx context.Context, _ *Logger) error {
+		close(starting)
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(context.Context, *Logger) error {
+		r.record("stop slow")
+		return nil
+	}, DependsOn("a"), StartTimeout(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-starting
+		cancel()
+	}()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() did not return after its context was cancelled")
+	}
+	want := []string{"start a", "stop a"}
+	if got := r.get(); !slices.Equal(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+}
+
+func TestComponentStartSignalled(t *testing.T) {
+	s := newTestService(t)
+	var r recorder
+	start, stop := r.component("a", nil)
+	s.AddComponent("a", start, stop)
+	s.AddComponent("slow", func(ctx context.Context, _ *Logger) error {
+		// signals are being watched by the time components start.
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil, DependsOn("a"), StartTimeout(time.Minute))
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() did not return after SIGTERM")
+	}
+	want := []string{"start a", "stop a"}
+	if got := r.get(); !slices.Equal(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+}
+
+func TestComponentStoppedAfterJobs(t *testing.T) {
+	s := newTestService(t)
+	var r recorder
+	start, stop := r.component("db", nil)
+	s.AddComponent("db", start, stop)
+	running := make(chan struct{})
+	s.AddJob(func(ctx context.Context, _ *Logger) error {
+		close(running)
+		<-ctx.Done()
+		// still using the component while winding down.
+		time.Sleep(100 * time.Millisecond)
+		r.record("job returned")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-running
+		cancel()
+	}()
+	if err := s.Run(ctx); err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+	want := []string{"start db", "job returned", "stop db"}
+	if got := r.get(); !slices.Equal(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v4"
 	"github.com/peterbourgon/ff/v4/ffval"
@@ -16,15 +17,30 @@ var (
 )
 
 type srvConfig struct {
-	logFormat string
-	logLevel  string
-	pushURL   string
-	flags     *ff.CoreFlags
+	logFormat       string
+	logLevel        string
+	pushURL         string
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	drainPeriod     time.Duration
+	upgradeTimeout  time.Duration
+	instrumentation string
+	tlsCertFile     string
+	tlsKeyFile      string
+	authToken       string
+	authTokenFile   string
+	authUsersFile   string
+	terminationLog  string
+	flags           *ff.CoreFlags
 }
 
-func initConfig() (*srvConfig, error) {
+// parseConfig parses the srv configuration flags from args and the
+// environment. The returned config is always usable, falling back to the
+// defaults for anything which could not be parsed.
+func parseConfig(args []string) (*srvConfig, error) {
 	config := &srvConfig{}
 	commonFlags := ff.NewFlags("srv config")
+	config.flags = commonFlags
 	commonFlags.AddFlag(ff.CoreFlagConfig{
 		LongName:    "log-level",
 		Placeholder: "debug|info|warn|error",
@@ -44,6 +60,45 @@ func initConfig() (*srvConfig, error) {
 			Default: "info",
 		},
 	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "shutdown-timeout",
+		Placeholder: "<duration>",
+		Usage:       "maximum time allowed for graceful shutdown before the service exits anyway - 0 waits forever",
+		Value: &ffval.Duration{
+			ParseFunc: parseDuration("shutdown timeout"),
+			Pointer:   &config.shutdownTimeout,
+			Default:   30 * time.Second,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "shutdown-delay",
+		Placeholder: "<duration>",
+		Usage:       "time to wait after receiving a shutdown signal before jobs are cancelled, so that the service can be removed from load balancers",
+		Value: &ffval.Duration{
+			ParseFunc: parseDuration("shutdown delay"),
+			Pointer:   &config.shutdownDelay,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "drain-period",
+		Placeholder: "<duration>",
+		Usage:       "time to wait after entering drain mode before the service shuts down",
+		Value: &ffval.Duration{
+			ParseFunc: parseDuration("drain period"),
+			Pointer:   &config.drainPeriod,
+			Default:   30 * time.Second,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "upgrade-timeout",
+		Placeholder: "<duration>",
+		Usage:       "maximum time to wait for a new process to become ready during an upgrade before giving up - 0 waits forever",
+		Value: &ffval.Duration{
+			ParseFunc: parseDuration("upgrade timeout"),
+			Pointer:   &config.upgradeTimeout,
+			Default:   time.Minute,
+		},
+	})
 	commonFlags.AddFlag(ff.CoreFlagConfig{
 		LongName:    "log-format",
 		Placeholder: "text|json|human|auto",
@@ -63,6 +118,57 @@ func initConfig() (*srvConfig, error) {
 			Default: "auto",
 		},
 	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "instrumentation-addr",
+		Placeholder: "<host:port>|unix:<path>|none",
+		Usage:       `address for the instrumentation server to listen on - port 0 picks a free port, "none" disables the server`,
+		Value: &ffval.String{
+			ParseFunc: parseInstrumentationAddr,
+			Pointer:   &config.instrumentation,
+			Default:   defaultInstrumentationAddr,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "instrumentation-tls-cert",
+		Placeholder: "<path to file>",
+		Usage:       "TLS certificate for the instrumentation server - reloaded when changed",
+		Value: &ffval.String{
+			Pointer: &config.tlsCertFile,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "instrumentation-tls-key",
+		Placeholder: "<path to file>",
+		Usage:       "TLS key for the instrumentation server - reloaded when changed",
+		Value: &ffval.String{
+			Pointer: &config.tlsKeyFile,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "instrumentation-token-file",
+		Placeholder: "<path to file>",
+		Usage:       "file containing the bearer token required for pprof and mutating instrumentation routes - the token may instead be set with " + instrumentationTokenEnv,
+		Value: &ffval.String{
+			Pointer: &config.authTokenFile,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "instrumentation-users-file",
+		Placeholder: "<path to file>",
+		Usage:       "file of user:password lines allowed to access pprof and mutating instrumentation routes with basic auth",
+		Value: &ffval.String{
+			Pointer: &config.authUsersFile,
+		},
+	})
+	commonFlags.AddFlag(ff.CoreFlagConfig{
+		LongName:    "termination-log",
+		Placeholder: "<path to file>|none",
+		Usage:       `file to write the reason for the service exiting to, created if necessary - defaults to /dev/termination-log in a container, "none" disables it`,
+		Value: &ffval.String{
+			Pointer: &config.terminationLog,
+			Default: defaultTermlog(),
+		},
+	})
 	commonFlags.AddFlag(ff.CoreFlagConfig{
 		LongName:    "push-url",
 		Placeholder: "http[s]://<Pushgateway host>",
@@ -96,7 +202,7 @@ func initConfig() (*srvConfig, error) {
 	})
 	// commonFlags.Bool(0, "version", false, "print version info")
 	// commonFlags.String(0, "config", "", "config file")
-	err := ff.Parse(commonFlags, os.Args[1:],
+	err := ff.Parse(commonFlags, args,
 		ff.WithEnvVars(),
 		ff.WithEnvVarPrefix("SRV"),
 		ff.WithConfigFileFlag("config"),
@@ -113,13 +219,35 @@ func initConfig() (*srvConfig, error) {
 	case errors.Is(err, os.ErrNotExist):
 		if configFlag, hasConfigFlag := commonFlags.GetFlag("config"); hasConfigFlag {
 			if configFlag.IsSet() {
-				return nil, fmt.Errorf("couldn't open config file: %v", err)
+				return config, fmt.Errorf("couldn't open config file: %v", err)
 			}
 		}
-		return nil, err
+		return config, err
 	default:
-		return nil, err
+		return config, err
+	}
+	if (config.tlsCertFile == "") != (config.tlsKeyFile == "") {
+		return config, fmt.Errorf("--instrumentation-tls-cert and --instrumentation-tls-key must be used together")
+	}
+	// the token itself is only taken from the environment, since command-line
+	// arguments are visible to other users, and at /debug/pprof/cmdline.
+	config.authToken = os.Getenv(instrumentationTokenEnv)
+	if config.authToken != "" && config.authTokenFile != "" {
+		return config, fmt.Errorf("%s and --instrumentation-token-file cannot be used together", instrumentationTokenEnv)
 	}
-	config.flags = commonFlags
 	return config, nil
 }
+
+// parseDuration returns a flag parsing function for non-negative durations.
+func parseDuration(name string) func(string) (time.Duration, error) {
+	return func(s string) (time.Duration, error) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		if d < 0 {
+			return 0, fmt.Errorf("%s cannot be negative", name)
+		}
+		return d, nil
+	}
+}
@@ -59,6 +59,18 @@ func Errorf(msg string, v ...any) *Error {
 	}
 }
 
+// Recovered returns a new error value for a value recovered from a panic, with
+// the stack trace of the panic. It must be called from the deferred function
+// which called recover(). If the value is itself an error, it can be unwrapped.
+func Recovered(v any) *Error {
+	err, _ := v.(error)
+	return &Error{
+		stack:      panicStack(),
+		msg:        fmt.Sprintf("panic: %v", v),
+		underlying: err,
+	}
+}
+
 // Error conforms to the stdlib error interface, allowing you to return this as
 // an error value.`
 func (e *Error) Error() string {
@@ -167,10 +179,36 @@ func (l *Location) Format(state fmt.State, verb rune) {
 func getStack() Stack {
 	stackptrs := make([]uintptr, 50)
 	stackptrs = stackptrs[:runtime.Callers(3, stackptrs)]
-	stack := make(Stack, 0, len(stackptrs))
+	return toStack(runtime.CallersFrames(stackptrs))
+}
+
+// panicStack returns the call stack from the point of a panic, skipping the
+// deferred function which recovered it.
+func panicStack() Stack {
+	stackptrs := make([]uintptr, 64)
+	stackptrs = stackptrs[:runtime.Callers(3, stackptrs)]
 	frames := runtime.CallersFrames(stackptrs)
 	for {
 		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			// the remaining frames start at the panic.
+			return toStack(frames)
+		}
+		if !more {
+			break
+		}
+	}
+	// not called during a panic, so use the whole stack.
+	return toStack(runtime.CallersFrames(stackptrs))
+}
+
+func toStack(frames *runtime.Frames) Stack {
+	var stack Stack
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "" {
+			break
+		}
 		if !strings.Contains(frame.File, "runtime/") {
 			frame.File = filepath.Base(frame.File)
 			if strings.HasPrefix(frame.Function, `main.`) && frame.Function[5] != '(' {
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"andy.dev/srv"
+)
+
+func main() {
+	srv.Declare(srv.ServiceInfo{
+		Name:   "componentsvc",
+		System: "srv examples",
+	})
+	// added out of order, but started db -> cache -> api and stopped in
+	// reverse.
+	srv.AddComponent("api", startFn("api"), stopFn("api"), srv.DependsOn("db", "cache"))
+	srv.AddComponent("cache", startFn("cache"), stopFn("cache"), srv.DependsOn("db"))
+	srv.AddComponent("db", startFn("db"), stopFn("db"), srv.StartTimeout(5*time.Second))
+	srv.AddJob(work)
+	srv.Serve()
+}
+
+func startFn(name string) srv.JobFn {
+	return func(_ context.Context, log *srv.Logger) error {
+		log.Info("connecting", "to", name)
+		time.Sleep(500 * time.Millisecond)
+		return nil
+	}
+}
+
+func stopFn(name string) srv.JobFn {
+	return func(_ context.Context, log *srv.Logger) error {
+		log.Info("disconnecting", "from", name)
+		return nil
+	}
+}
+
+func work(_ context.Context, log *srv.Logger) error {
+	log.Info("all components are up, working")
+	time.Sleep(2 * time.Second)
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"andy.dev/srv"
+)
+
+func main() {
+	srv.Declare(srv.ServiceInfo{
+		Name:   "dynamicsvc",
+		System: "srv examples",
+	})
+	srv.AddNamedJob("discovery", discover)
+	srv.Serve()
+}
+
+// discover starts a consumer for each tenant as it is found. The service will
+// keep running until all of them have finished.
+func discover(_ context.Context, log *srv.Logger) error {
+	for _, tenant := range []string{"acme", "globex", "initech"} {
+		time.Sleep(time.Second)
+		log.Info("found tenant", "tenant", tenant)
+		if err := srv.Go("consumer-"+tenant, srv.Fn(consume, tenant)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func consume(ctx context.Context, log *srv.Logger, tenant string) error {
+	for i := 1; i <= 3; i++ {
+		select {
+		case <-time.After(2 * time.Second):
+			log.Info("consumed message", "tenant", tenant, "message_number", i)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"andy.dev/srv"
+)
+
+func main() {
+	srv.Declare(srv.ServiceInfo{
+		Name:   "scheduledsvc",
+		System: "srv examples",
+	})
+	srv.AddPeriodicJob("refresh", 5*time.Second, refresh,
+		srv.RandomDelay(time.Second))
+	srv.AddCronJob("report", "*/1 * * * *", report,
+		srv.Overlap(srv.QueueOverlap))
+	srv.Serve()
+}
+
+func refresh(_ context.Context, log *srv.Logger) error {
+	log.Info("refreshing")
+	return nil
+}
+
+func report(ctx context.Context, log *srv.Logger) error {
+	log.Info("writing report")
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"andy.dev/srv"
+	"andy.dev/srv/errors"
+)
+
+func main() {
+	srv.Declare(srv.ServiceInfo{
+		Name: "supervisedsvc",
+	})
+	srv.AddSupervisedJob(flakyJob,
+		srv.Restart(3, time.Minute),
+		srv.Backoff(time.Second, 10*time.Second))
+	srv.Serve()
+}
+
+func flakyJob(_ context.Context, log *srv.Logger) error {
+	for i := 1; i <= 3; i++ {
+		log.Info("working", "message_number", i)
+		doWork()
+	}
+	return errors.New("I fell over")
+}
+
+func doWork() {
+	time.Sleep(1 * time.Second)
+}
@@ -0,0 +1,94 @@
+package srv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes used by srv. These are stable, and can be relied upon by
+// orchestrators deciding whether to retry a service. Jobs can exit with codes
+// of their own using [ExitCode]; codes between 4 and 123 will not collide with
+// any used by srv, or by shells.
+const (
+	// ExitOK means that the service shut down cleanly.
+	ExitOK = 0
+	// ExitFailure means that a job failed, or that the service could not
+	// start.
+	ExitFailure = 1
+	// ExitConfig means that the service was misconfigured, either by its
+	// flags, or by incorrect use of the srv API.
+	ExitConfig = 2
+	// ExitShutdownHandler means that the service shut down for a normal
+	// reason, but a shutdown handler or component failed while stopping, or
+	// metrics could not be pushed.
+	ExitShutdownHandler = 3
+	// ExitShutdownTimeout means that graceful shutdown took longer than
+	// --shutdown-timeout. Same as timeout(1).
+	ExitShutdownTimeout = 124
+	// ExitForced means that the service was forced to exit by a signal without
+	// completing graceful shutdown. Same as a shell's ctrl-c.
+	ExitForced = 130
+)
+
+// ExitCoder is implemented by errors which carry the exit code the service
+// should exit with. It is checked for with [errors.As], so it may be wrapped.
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+// ExitCode returns an error which will cause the service to exit with the
+// given code, if returned from a job or shutdown handler. If err is nil,
+// ExitCode returns nil.
+//
+// Example:
+//
+//	if errors.Is(err, errTemporary) {
+//		return srv.ExitCode(err, 75) // EX_TEMPFAIL
+//	}
+func ExitCode(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// ExitError is an error carrying an exit code. It is created by [ExitCode],
+// and is returned by [Service.Run] when the service does not shut down
+// cleanly, holding the code the program would have exited with had it been run
+// with [Serve].
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d: %v", e.Code, e.Err)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the code the service should exit with.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// exitStatus returns the status the program should exit with for an error: the
+// code of the first [ExitCoder] in its tree, or [ExitFailure].
+func exitStatus(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var coder ExitCoder
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	return ExitFailure
+}
+
+func hasExitCode(err error) bool {
+	var coder ExitCoder
+	return errors.As(err, &coder)
+}
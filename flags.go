@@ -17,7 +17,6 @@ var (
 	muFlags          sync.Mutex
 	didParse         bool
 	hasUserFlags     bool
-	srvFlags         *ff.CoreFlags
 	srvProvidedFlags []providerCtx
 	userFlags        = ff.NewFlags("")
 )
@@ -27,13 +26,15 @@ var errAlreadyParsed = errors.New("ParseFlags(): ignoring duplicate call")
 // ParseFlags parses all command-line flags and returns the remaining arguments.
 func ParseFlags() []string {
 	caller := log.Up(1)
-	srvMu.Lock()
-	defer srvMu.Unlock()
-	if didServe {
+	std.mu.Lock()
+	if std.served {
 		sFatal(caller, "ParseFlags() called after Serve(), user flags could be invalid.")
 	}
 	args, err := parseFlags()
+	std.mu.Unlock()
 	switch {
+	case err == nil:
+		std.emit(Event{Type: EventFlagsParsed})
 	case errors.Is(err, errAlreadyParsed):
 		// already have the package instance. Use it to log a warning
 		sWarn(caller, err.Error())
@@ -50,7 +51,7 @@ func parseFlags() ([]string, error) {
 		return nil, errAlreadyParsed
 	}
 	didParse = true
-	combinedFlags := srvFlags
+	combinedFlags := std.config.flags
 
 	if hasUserFlags {
 		flagN := combinedFlags
@@ -238,7 +239,7 @@ func addUserFlagVar(flagName string, flag ff.CoreFlagConfig) {
 	muFlags.Lock()
 	defer muFlags.Unlock()
 	caller := log.Up(2)
-	if didServe {
+	if std.served {
 		sFatal(caller, "flags can't be added after Serve()")
 	}
 	if didParse {
@@ -261,7 +262,7 @@ func addUserFlag[T any](flagName string, defaultValue T, usage string, setter fu
 	muFlags.Lock()
 	defer muFlags.Unlock()
 	caller := log.Up(2)
-	if didServe {
+	if std.served {
 		sFatal(caller, "flags can't be added after Serve()")
 	}
 	if didParse {
@@ -285,7 +286,7 @@ func addUserFlagNoDefault[T any](flagName string, usage string, setter func(rune
 	muFlags.Lock()
 	defer muFlags.Unlock()
 	caller := log.Up(2)
-	if didServe {
+	if std.served {
 		sFatal(caller, "flags can't be added after Serve()")
 	}
 	if didParse {
@@ -7,10 +7,27 @@ import (
 	"andy.dev/srv/internal/health"
 )
 
-var srvHealth *health.Handler
+func (s *Service) initHealth() {
+	s.health = health.NewHandler(s.ctx)
+	s.readiness = health.NewReadinessHandler(s.ctx)
+	s.startup = health.NewStartupHandler()
+	onPanic := func(checkID string, err error) {
+		s.termLogErr(noloc, "health check panicked", err, "healthcheck_id", checkID)
+	}
+	s.health.OnPanic(onPanic)
+	s.readiness.OnPanic(onPanic)
+	s.health.SetMetrics(s.checkMetrics("health"))
+	s.readiness.SetMetrics(s.checkMetrics("readiness"))
+}
 
-func initHealth() {
-	srvHealth = health.NewHandler(srvCtx)
+// checkMetrics returns the metrics for checks of the given type.
+func (s *Service) checkMetrics(checkType string) health.Metrics {
+	return health.Metrics{
+		Status:              s.metrics.healthStatus.With("type", checkType),
+		ConsecutiveFailures: s.metrics.healthFailures.With("type", checkType),
+		Duration:            s.metrics.healthDuration.With("type", checkType),
+		Failures:            s.metrics.healthFailed.With("type", checkType),
+	}
 }
 
 type HealthCheckOption func(hc *health.HealthCheck) error
@@ -40,10 +57,12 @@ func Timeout(timeout time.Duration) HealthCheckOption {
 	}
 }
 
-// MaxFailures sets the number of acceptable failures before the health check is
-// considered failed. If the check returns nil (success) before this number is
-// reached, the counter will be reset, and the check will remain healthy.
-// Default: 0 (no failures allowed)
+// MaxFailures sets the number of consecutive failures after which the health
+// check is considered failed. If the check returns nil (success) before this
+// number is reached, the counter will be reset, and the check will remain
+// healthy. Once it has failed, a success no longer resets it, and it stays
+// failed unless [RecoverAfter] is used. Default: 1 (the first failure fails the
+// check)
 func MaxFailures(maxFailures int) HealthCheckOption {
 	return func(hc *health.HealthCheck) error {
 		if maxFailures <= 0 {
@@ -53,3 +72,29 @@ func MaxFailures(maxFailures int) HealthCheckOption {
 		return nil
 	}
 }
+
+// RecoverAfter keeps running a health check after it has failed, marking it as
+// healthy again once it has succeeded the given number of times in a row.
+// Without it, a failed health check stays failed, leaving the service unhealthy
+// until it is restarted. Readiness checks always recover, after a single
+// success by default.
+func RecoverAfter(successes int) HealthCheckOption {
+	return func(hc *health.HealthCheck) error {
+		if successes <= 0 {
+			return fmt.Errorf("successes must be greater than 0")
+		}
+		hc.RecoverAfter = successes
+		return nil
+	}
+}
+
+// NonCritical marks a check as non-critical, for dependencies which the
+// service can run without, such as a metrics sink. If a non-critical check
+// fails, the service is reported as DEGRADED, but /livez or /readyz still
+// return 200 OK.
+func NonCritical() HealthCheckOption {
+	return func(hc *health.HealthCheck) error {
+		hc.NonCritical = true
+		return nil
+	}
+}
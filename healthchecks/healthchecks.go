@@ -0,0 +1,19 @@
+// Package healthchecks provides ready-made health checks for common
+// dependencies and failure modes, for use with srv.AddHealthCheck and
+// srv.AddReadinessCheck:
+//
+//	srv.AddHealthCheck("db", healthchecks.Ping(db))
+//	srv.AddReadinessCheck("api", healthchecks.HTTPGet("http://api.internal/healthz"))
+//
+// Each check is bounded by the timeout of the health check which runs it.
+package healthchecks
+
+import (
+	"context"
+
+	"andy.dev/srv/log"
+)
+
+// Check is a health check. It has the same signature as srv.JobFn, so it may
+// be passed directly to srv.AddHealthCheck.
+type Check = func(ctx context.Context, logger *log.Logger) error
@@ -0,0 +1,51 @@
+package healthchecks
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"andy.dev/srv/log"
+)
+
+// Heartbeat detects loops which have become stuck. The loop calls
+// [Heartbeat.Beat] each time it makes progress, and the check returned by
+// [Heartbeat.Check] fails if it has not done so recently:
+//
+//	hb := healthchecks.NewHeartbeat()
+//	srv.AddHealthCheck("worker", hb.Check(time.Minute))
+//	srv.AddJob(func(ctx context.Context, log *srv.Logger) error {
+//		for {
+//			hb.Beat()
+//			// ...
+//		}
+//	})
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+// NewHeartbeat returns a new Heartbeat, which counts as having beaten when it
+// was created.
+func NewHeartbeat() *Heartbeat {
+	hb := &Heartbeat{}
+	hb.Beat()
+	return hb
+}
+
+// Beat records that the loop has made progress.
+func (hb *Heartbeat) Beat() {
+	hb.last.Store(time.Now().UnixNano())
+}
+
+// Check returns a check which fails if there has been no beat within the last
+// maxAge.
+func (hb *Heartbeat) Check(maxAge time.Duration) Check {
+	return func(context.Context, *log.Logger) error {
+		last := time.Unix(0, hb.last.Load())
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("no heartbeat for %s, more than %s", age.Round(time.Millisecond), maxAge)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,21 @@
+package healthchecks
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	hb := NewHeartbeat()
+	check := hb.Check(time.Minute)
+	if err := check(context.Background(), nil); err != nil {
+		t.Errorf("check failed for a new heartbeat: %v", err)
+	}
+	hb.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	checkErr(t, check(context.Background(), nil), "no heartbeat for 2m0")
+	hb.Beat()
+	if err := check(context.Background(), nil); err != nil {
+		t.Errorf("check failed after a beat: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package healthchecks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"andy.dev/srv/log"
+)
+
+// maxBodySize is the most of a response body which HTTPGet will read.
+const maxBodySize = 1 << 20
+
+// TCP checks that a TCP connection can be made to addr, which is of the form
+// "host:port".
+func TCP(addr string) Check {
+	return func(ctx context.Context, _ *log.Logger) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// DNS checks that host resolves to at least one address.
+func DNS(host string) Check {
+	return func(ctx context.Context, _ *log.Logger) error {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("%s did not resolve to any addresses", host)
+		}
+		return nil
+	}
+}
+
+// HTTPOption configures an [HTTPGet] check.
+type HTTPOption func(hc *httpCheck)
+
+type httpCheck struct {
+	client   *http.Client
+	statuses []int
+	body     *regexp.Regexp
+}
+
+// ExpectStatus sets the status codes which the response may have. Default: any
+// 2xx status.
+func ExpectStatus(codes ...int) HTTPOption {
+	return func(hc *httpCheck) {
+		hc.statuses = codes
+	}
+}
+
+// ExpectBody requires the response body to match pattern. Only the first
+// megabyte of the body is read.
+func ExpectBody(pattern *regexp.Regexp) HTTPOption {
+	return func(hc *httpCheck) {
+		hc.body = pattern
+	}
+}
+
+// WithClient sets the client used to make the request, such as one with a
+// custom TLS configuration. Default: [http.DefaultClient]
+func WithClient(client *http.Client) HTTPOption {
+	return func(hc *httpCheck) {
+		hc.client = client
+	}
+}
+
+// HTTPGet checks that a GET request to url succeeds.
+func HTTPGet(url string, options ...HTTPOption) Check {
+	hc := &httpCheck{
+		client: http.DefaultClient,
+	}
+	for _, o := range options {
+		o(hc)
+	}
+	return func(ctx context.Context, _ *log.Logger) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := hc.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch {
+		case len(hc.statuses) > 0:
+			if !slices.Contains(hc.statuses, resp.StatusCode) {
+				return fmt.Errorf("unexpected status %s", resp.Status)
+			}
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if hc.body == nil {
+			return nil
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		if !hc.body.Match(body) {
+			return fmt.Errorf("body does not match %q", hc.body)
+		}
+		return nil
+	}
+}
+
+// Pinger is anything which can check its connection, such as a *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Ping checks that p can reach its backend, such as a database.
+func Ping(p Pinger) Check {
+	return func(ctx context.Context, _ *log.Logger) error {
+		return p.PingContext(ctx)
+	}
+}
@@ -0,0 +1,99 @@
+package healthchecks
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHTTPGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			io.WriteString(w, `{"status":"ok"}`)
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		case "/large":
+			io.WriteString(w, strings.Repeat("x", maxBodySize)+"end")
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	noRedirects := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	tests := []struct {
+		name    string
+		path    string
+		options []HTTPOption
+		wantErr string
+	}{
+		{name: "ok", path: "/ok"},
+		{name: "any 2xx", path: "/created"},
+		{name: "error status", path: "/down", wantErr: "unexpected status 503 Service Unavailable"},
+		{name: "expected status", path: "/down", options: []HTTPOption{ExpectStatus(http.StatusServiceUnavailable)}},
+		{name: "unexpected status", path: "/created", options: []HTTPOption{ExpectStatus(http.StatusOK)}, wantErr: "unexpected status 201 Created"},
+		{name: "follows redirects", path: "/redirect", options: []HTTPOption{ExpectStatus(http.StatusOK)}},
+		{name: "client", path: "/redirect", options: []HTTPOption{WithClient(noRedirects), ExpectStatus(http.StatusFound)}},
+		{name: "body matches", path: "/ok", options: []HTTPOption{ExpectBody(regexp.MustCompile(`"status":"ok"`))}},
+		{name: "body does not match", path: "/ok", options: []HTTPOption{ExpectBody(regexp.MustCompile(`"status":"degraded"`))}, wantErr: "body does not match"},
+		{name: "body read is limited", path: "/large", options: []HTTPOption{ExpectBody(regexp.MustCompile(`end`))}, wantErr: "body does not match"},
+		{name: "status checked before body", path: "/down", options: []HTTPOption{ExpectBody(regexp.MustCompile(`unavailable`))}, wantErr: "unexpected status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := HTTPGet(srv.URL+tt.path, tt.options...)(context.Background(), nil)
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHTTPGetCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("request made with a cancelled context")
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := HTTPGet(srv.URL)(ctx, nil); err == nil {
+		t.Error("check succeeded with a cancelled context")
+	}
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	check := TCP(addr)
+	if err := check(context.Background(), nil); err != nil {
+		t.Errorf("check failed with a listener: %v", err)
+	}
+	l.Close()
+	if err := check(context.Background(), nil); err == nil {
+		t.Error("check succeeded without a listener")
+	}
+}
+
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("check failed: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("check succeeded, want error containing %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("check failed with %q, want error containing %q", err, want)
+	}
+}
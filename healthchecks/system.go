@@ -0,0 +1,112 @@
+package healthchecks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"andy.dev/srv/log"
+)
+
+// DiskFree checks that the filesystem containing path has at least minBytes
+// available to unprivileged users.
+func DiskFree(path string, minBytes uint64) Check {
+	return func(context.Context, *log.Logger) error {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(path, &st); err != nil {
+			return err
+		}
+		free := uint64(st.Bavail) * uint64(st.Bsize)
+		if free < minBytes {
+			return fmt.Errorf("%s has %d bytes free, need %d", path, free, minBytes)
+		}
+		return nil
+	}
+}
+
+// InodesFree checks that the filesystem containing path has at least minInodes
+// free inodes.
+func InodesFree(path string, minInodes uint64) Check {
+	return func(context.Context, *log.Logger) error {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(path, &st); err != nil {
+			return err
+		}
+		free := uint64(st.Ffree)
+		if free < minInodes {
+			return fmt.Errorf("%s has %d inodes free, need %d", path, free, minInodes)
+		}
+		return nil
+	}
+}
+
+// FileFresh checks that the file at path exists and was modified within the
+// last maxAge, such as a file written by a periodic export.
+func FileFresh(path string, maxAge time.Duration) Check {
+	return func(context.Context, *log.Logger) error {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if age := time.Since(fi.ModTime()); age > maxAge {
+			return fmt.Errorf("%s was last modified %s ago, more than %s", path, age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
+
+// Goroutines checks that there are no more than max goroutines, which would
+// suggest that they are leaking.
+func Goroutines(max int) Check {
+	return func(context.Context, *log.Logger) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return fmt.Errorf("%d goroutines, more than %d", n, max)
+		}
+		return nil
+	}
+}
+
+// HeapSize checks that the heap holds no more than maxBytes of objects.
+func HeapSize(maxBytes uint64) Check {
+	return func(context.Context, *log.Logger) error {
+		sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+		metrics.Read(sample)
+		if sample[0].Value.Kind() != metrics.KindUint64 {
+			return fmt.Errorf("heap size is not available")
+		}
+		if heap := sample[0].Value.Uint64(); heap > maxBytes {
+			return fmt.Errorf("heap is %d bytes, more than %d", heap, maxBytes)
+		}
+		return nil
+	}
+}
+
+// RSS checks that the resident set size of the process is no more than
+// maxBytes. It is only supported on Linux, and fails elsewhere.
+func RSS(maxBytes uint64) Check {
+	return func(context.Context, *log.Logger) error {
+		statm, err := os.ReadFile("/proc/self/statm")
+		if err != nil {
+			return fmt.Errorf("failed to read RSS: %w", err)
+		}
+		// the second field is the number of resident pages.
+		fields := strings.Fields(string(statm))
+		if len(fields) < 2 {
+			return fmt.Errorf("failed to read RSS: unexpected statm %q", statm)
+		}
+		pages, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to read RSS: %w", err)
+		}
+		if rss := pages * uint64(os.Getpagesize()); rss > maxBytes {
+			return fmt.Errorf("RSS is %d bytes, more than %d", rss, maxBytes)
+		}
+		return nil
+	}
+}
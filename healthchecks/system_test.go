@@ -0,0 +1,54 @@
+package healthchecks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileFresh(t *testing.T) {
+	dir := t.TempDir()
+	fresh := filepath.Join(dir, "fresh")
+	stale := filepath.Join(dir, "stale")
+	for _, path := range []string{fresh, stale} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"fresh", fresh, ""},
+		{"stale", stale, "was last modified 2h0m0s ago, more than 1h0m0s"},
+		{"missing", filepath.Join(dir, "missing"), "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr(t, FileFresh(tt.path, time.Hour)(context.Background(), nil), tt.wantErr)
+		})
+	}
+}
+
+func TestDiskFree(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskFree(dir, 0)(context.Background(), nil); err != nil {
+		t.Errorf("check failed needing no space: %v", err)
+	}
+	checkErr(t, DiskFree(dir, 1<<62)(context.Background(), nil), "bytes free, need")
+	checkErr(t, DiskFree(filepath.Join(dir, "missing"), 0)(context.Background(), nil), "no such file or directory")
+}
+
+func TestGoroutines(t *testing.T) {
+	if err := Goroutines(1<<20)(context.Background(), nil); err != nil {
+		t.Errorf("check failed: %v", err)
+	}
+	checkErr(t, Goroutines(0)(context.Background(), nil), "more than 0")
+}
@@ -16,12 +16,12 @@ const (
 
 func versionText() string {
 	var sb strings.Builder
-	sb.WriteString(srvInfo.Name)
-	if srvInfo.Version == "" {
+	sb.WriteString(std.serviceInfo.Name)
+	if std.serviceInfo.Version == "" {
 		sb.WriteString(" <no version>")
 	} else {
 		sb.WriteString(" v")
-		sb.WriteString(srvInfo.Version)
+		sb.WriteString(std.serviceInfo.Version)
 	}
 	sb.WriteString(" ")
 	sb.WriteString(getBuildData().String())
@@ -31,9 +31,9 @@ func versionText() string {
 func flagsHelp(flags *ff.CoreFlags) (string, error) {
 	var sb strings.Builder
 	// TODO: better place for serviceinfo? Not in instance
-	sb.WriteString(srvInfo.Name + "\n")
-	if srvInfo.About != "" {
-		sb.WriteString(helpBlock(srvInfo.About) + "\n")
+	sb.WriteString(std.serviceInfo.Name + "\n")
+	if std.serviceInfo.About != "" {
+		sb.WriteString(helpBlock(std.serviceInfo.About) + "\n")
 	}
 	sb.WriteString("FLAGS")
 	sec := ""
@@ -0,0 +1,103 @@
+package srv
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"andy.dev/srv/internal/auth"
+)
+
+const (
+	defaultInstrumentationAddr = ":8081"
+	// instrumentationDisabled is the --instrumentation-addr value which
+	// disables the instrumentation server entirely.
+	instrumentationDisabled = "none"
+	unixAddrPrefix          = "unix:"
+	// instrumentationTokenEnv holds the bearer token for the instrumentation
+	// server. There is deliberately no flag for it.
+	instrumentationTokenEnv = "SRV_INSTRUMENTATION_TOKEN"
+)
+
+// parseInstrumentationAddr validates the --instrumentation-addr flag.
+func parseInstrumentationAddr(addr string) (string, error) {
+	switch {
+	case addr == instrumentationDisabled:
+	case strings.HasPrefix(addr, unixAddrPrefix):
+		if strings.TrimPrefix(addr, unixAddrPrefix) == "" {
+			return "", fmt.Errorf("unix socket path cannot be empty")
+		}
+	default:
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return "", err
+		}
+	}
+	return addr, nil
+}
+
+// listen opens a listener on an address of the form accepted by
+// --instrumentation-addr. It returns a nil listener if the address is "none".
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case addr == instrumentationDisabled:
+		return nil, nil
+	case strings.HasPrefix(addr, unixAddrPrefix):
+		path := strings.TrimPrefix(addr, unixAddrPrefix)
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// removeStaleSocket removes a unix socket left behind by a previous process,
+// which would otherwise prevent us from listening. Anything other than a
+// socket is left alone, as is a socket which another process is still
+// listening on.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case fi.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	// only a refused connection shows that nothing is listening.
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	switch {
+	case err == nil:
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	case !errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("failed to check whether %s is in use: %w", path, err)
+	}
+	return os.Remove(path)
+}
+
+// newAuthenticator loads the credentials for the instrumentation routes from
+// the token and users files, if provided.
+func (s *Service) newAuthenticator() (*auth.Authenticator, error) {
+	token := s.config.authToken
+	if s.config.authTokenFile != "" {
+		var err error
+		if token, err = auth.ReadToken(s.config.authTokenFile); err != nil {
+			return nil, fmt.Errorf("failed to read instrumentation token: %w", err)
+		}
+	}
+	var users map[string]string
+	if s.config.authUsersFile != "" {
+		var err error
+		if users, err = auth.ReadUsers(s.config.authUsersFile); err != nil {
+			return nil, fmt.Errorf("failed to read instrumentation users: %w", err)
+		}
+	}
+	return auth.New(token, users, s.rootLogger().With("logger", "instrumentation_auth"), s.metrics.authFailures), nil
+}
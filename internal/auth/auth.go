@@ -0,0 +1,158 @@
+// Package auth provides bearer token and basic authentication for the
+// instrumentation routes.
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"andy.dev/srv/log"
+	"github.com/go-kit/kit/metrics"
+)
+
+// Policy determines whether a route requires credentials.
+type Policy int
+
+const (
+	// Open routes never require credentials.
+	Open Policy = iota
+	// ProtectMutating routes require credentials for any method other than
+	// GET or HEAD.
+	ProtectMutating
+	// Protected routes always require credentials.
+	Protected
+)
+
+// Authenticator checks requests for a bearer token or basic auth credentials.
+// If no credentials have been configured, all requests are allowed.
+type Authenticator struct {
+	token    [sha256.Size]byte
+	hasToken bool
+	users    map[string][sha256.Size]byte
+	logger   *log.Logger
+	failures metrics.Counter
+}
+
+// New returns an Authenticator accepting the given bearer token and basic auth
+// users, either of which may be empty. Failed attempts are logged to logger and
+// counted with failures, labeled by reason.
+func New(token string, users map[string]string, logger *log.Logger, failures metrics.Counter) *Authenticator {
+	a := &Authenticator{
+		users:    make(map[string][sha256.Size]byte, len(users)),
+		logger:   logger,
+		failures: failures,
+	}
+	if token != "" {
+		a.token = sha256.Sum256([]byte(token))
+		a.hasToken = true
+	}
+	for user, pass := range users {
+		a.users[user] = sha256.Sum256([]byte(pass))
+	}
+	return a
+}
+
+// Enabled reports whether any credentials have been configured.
+func (a *Authenticator) Enabled() bool {
+	return a.hasToken || len(a.users) > 0
+}
+
+// Wrap returns a handler which enforces the given policy before calling next.
+func (a *Authenticator) Wrap(policy Policy, next http.Handler) http.Handler {
+	if policy == Open || !a.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if policy == ProtectMutating && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if reason := a.check(r); reason != "" {
+			a.logger.Warn("instrumentation request denied", "reason", reason, "path", r.URL.Path, "method", r.Method, "remote_addr", r.RemoteAddr)
+			a.failures.With("reason", reason).Add(1)
+			if a.hasToken {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="srv"`)
+			}
+			if len(a.users) > 0 {
+				w.Header().Add("WWW-Authenticate", `Basic realm="srv"`)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check returns the reason a request is not authorized, or an empty string if
+// it is.
+func (a *Authenticator) check(r *http.Request) string {
+	authz := r.Header.Get("Authorization")
+	if authz == "" {
+		return "missing_credentials"
+	}
+	if token, ok := strings.CutPrefix(authz, "Bearer "); ok {
+		if !a.hasToken {
+			return "unsupported_scheme"
+		}
+		sum := sha256.Sum256([]byte(token))
+		if subtle.ConstantTimeCompare(sum[:], a.token[:]) != 1 {
+			return "invalid_token"
+		}
+		return ""
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok || len(a.users) == 0 {
+		return "unsupported_scheme"
+	}
+	want, found := a.users[user]
+	sum := sha256.Sum256([]byte(pass))
+	if subtle.ConstantTimeCompare(sum[:], want[:]) != 1 || !found {
+		return "invalid_credentials"
+	}
+	return ""
+}
+
+// ReadToken reads a bearer token from a file, ignoring surrounding whitespace.
+func ReadToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// ReadUsers reads basic auth users from a file containing one user:password
+// pair per line. Blank lines and lines beginning with # are ignored.
+func ReadUsers(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, pass, ok := strings.Cut(line, ":")
+		if !ok || user == "" || pass == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:password", path, lineNo)
+		}
+		users[user] = pass
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,230 @@
+// Package cron parses standard 5-field cron schedules and computes their
+// activation times.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchYears is how far ahead Next will look for an activation time before
+// giving up, which happens for schedules such as "0 0 30 2 *".
+const searchYears = 5
+
+// Schedule is a parsed cron schedule, made up of a bitset of allowed values for
+// each field.
+type Schedule struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+	loc     *time.Location
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	months = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	days = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+	fields = [5]field{
+		{"minute", 0, 59, nil},
+		{"hour", 0, 23, nil},
+		{"day of month", 1, 31, nil},
+		{"month", 1, 12, months},
+		// 7 is also accepted for Sunday
+		{"day of week", 0, 7, days},
+	}
+	macros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse parses a schedule of the form "minute hour day-of-month month
+// day-of-week", evaluated in the given location. Each field may be a "*", a
+// value, a range ("1-5"), a list ("1,3,5") or any of these with a step
+// ("*/15", "0-30/10"). Months and days of the week may also be given by their
+// three-letter English names. The macros @yearly, @annually, @monthly, @weekly,
+// @daily, @midnight and @hourly are also accepted.
+//
+// As with standard cron, if both the day of month and day of week are
+// restricted, a day matching either of them will match.
+func Parse(spec string, loc *time.Location) (*Schedule, error) {
+	if loc == nil {
+		return nil, fmt.Errorf("location cannot be nil")
+	}
+	spec = strings.TrimSpace(spec)
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	exprs := strings.Fields(spec)
+	if len(exprs) != len(fields) {
+		return nil, fmt.Errorf("expected %d fields, found %d", len(fields), len(exprs))
+	}
+	var bits [len(fields)]uint64
+	for i, expr := range exprs {
+		b, err := parseField(expr, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fields[i].name, err)
+		}
+		bits[i] = b
+	}
+	s := &Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(exprs[2], "*"),
+		dowStar: strings.HasPrefix(exprs[4], "*"),
+		loc:     loc,
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(loStr, f); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if hi, err = parseValue(hiStr, f); err != nil {
+					return 0, err
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q", rng)
+		}
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d-%d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first activation time of the schedule after t, or the zero
+// time if there is none within the next few years.
+//
+// Times skipped by a daylight saving transition never match, and times that
+// occur twice match twice.
+func (s *Schedule) Next(t time.Time) time.Time {
+	// minutes and hours are advanced in absolute time rather than with
+	// time.Date, which normalizes wall-clock times that are skipped or
+	// repeated and could step backwards across a transition.
+	t = t.Truncate(time.Minute).Add(time.Minute).In(s.loc)
+	limit := t.Year() + searchYears
+	// each field is advanced until it matches. When a field moves on a larger
+	// one, the larger fields may no longer match, so we start over.
+WRAP:
+	for t.Year() <= limit {
+		for !has(s.month, int(t.Month())) {
+			t = startOfDay(t.Year(), t.Month()+1, 1, s.loc)
+			if t.Month() == time.January {
+				continue WRAP
+			}
+		}
+		for !s.dayMatches(t) {
+			t = startOfDay(t.Year(), t.Month(), t.Day()+1, s.loc)
+			if t.Day() == 1 {
+				continue WRAP
+			}
+		}
+		for !has(s.hour, t.Hour()) {
+			day := t.Day()
+			t = t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+			if t.Day() != day {
+				continue WRAP
+			}
+		}
+		for !has(s.minute, t.Minute()) {
+			hour := t.Hour()
+			t = t.Add(time.Minute)
+			if t.Hour() != hour {
+				continue WRAP
+			}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// startOfDay returns the first instant of the given day, which is normalized
+// as by time.Date. When a daylight saving transition skips midnight, time.Date
+// puts it on the day before, so the day starts on the first hour after that
+// instead.
+func startOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	noon := time.Date(year, month, day, 12, 0, 0, 0, loc)
+	for t.Day() != noon.Day() {
+		t = t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+	}
+	return t
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<v) != 0
+}
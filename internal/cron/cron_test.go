@@ -0,0 +1,122 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"empty", ""},
+		{"too few fields", "* * * *"},
+		{"too many fields", "* * * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "* 24 * * *"},
+		{"day of month zero", "* * 0 * *"},
+		{"month out of range", "* * * 13 *"},
+		{"day of week out of range", "* * * * 8"},
+		{"reversed range", "5-1 * * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"negative step", "*/-1 * * * *"},
+		{"invalid value", "a * * * *"},
+		{"invalid name", "* * * foo *"},
+		{"unknown macro", "@fortnightly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.spec, time.UTC); err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", tt.spec)
+			}
+		})
+	}
+	if _, err := Parse("* * * * *", nil); err == nil {
+		t.Error("Parse with nil location succeeded, want error")
+	}
+}
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Santiago's transitions happen at midnight.
+	scl, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		spec string
+		loc  *time.Location
+		from time.Time
+		want time.Time
+	}{
+		{"next minute", "* * * * *", time.UTC, utc(2024, 9, 2, 10, 0), utc(2024, 9, 2, 10, 1)},
+		{"truncates seconds", "* * * * *", time.UTC, utc(2024, 9, 2, 10, 0).Add(30 * time.Second), utc(2024, 9, 2, 10, 1)},
+		{"macro", "@hourly", time.UTC, utc(2024, 9, 2, 10, 30), utc(2024, 9, 2, 11, 0)},
+		{"step", "*/15 * * * *", time.UTC, utc(2024, 9, 2, 10, 50), utc(2024, 9, 2, 11, 0)},
+		{"month wrap", "0 0 1 * *", time.UTC, utc(2024, 1, 31, 12, 0), utc(2024, 2, 1, 0, 0)},
+		{"year wrap", "0 0 1 1 *", time.UTC, utc(2024, 6, 15, 0, 0), utc(2025, 1, 1, 0, 0)},
+		{"last minute of year", "59 23 31 12 *", time.UTC, utc(2024, 12, 31, 23, 59), utc(2025, 12, 31, 23, 59)},
+		{"month name", "0 0 1 mar *", time.UTC, utc(2024, 3, 2, 0, 0), utc(2025, 3, 1, 0, 0)},
+		{"feb 29", "0 12 29 2 *", time.UTC, utc(2024, 3, 1, 0, 0), utc(2028, 2, 29, 12, 0)},
+		{"31st skips short months", "0 0 31 * *", time.UTC, utc(2024, 4, 1, 0, 0), utc(2024, 5, 31, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", time.UTC, utc(2024, 9, 2, 0, 0), utc(2024, 9, 8, 0, 0)},
+		{"day name", "0 0 * * fri", time.UTC, utc(2024, 9, 2, 0, 0), utc(2024, 9, 6, 0, 0)},
+		{"dom or dow matches dom", "0 0 10 * 5", time.UTC, utc(2024, 9, 7, 0, 0), utc(2024, 9, 10, 0, 0)},
+		{"dom or dow matches dow", "0 0 10 * 5", time.UTC, utc(2024, 9, 2, 0, 0), utc(2024, 9, 6, 0, 0)},
+		{"dom and starred dow", "0 0 1 * */2", time.UTC, utc(2024, 9, 2, 0, 0), utc(2024, 10, 1, 0, 0)},
+		{"starred dom and dow", "0 0 */2 * 1", time.UTC, utc(2024, 9, 2, 0, 0), utc(2024, 9, 9, 0, 0)},
+		{"impossible", "0 0 30 2 *", time.UTC, utc(2024, 1, 1, 0, 0), time.Time{}},
+		{"impossible day of month", "0 0 31 4,6,9,11 *", time.UTC, utc(2024, 1, 1, 0, 0), time.Time{}},
+		{"in location", "0 9 * * *", ny, utc(2024, 9, 2, 12, 0), utc(2024, 9, 2, 13, 0)},
+
+		// 2024-03-10 02:00 EST becomes 03:00 EDT
+		{"spring forward skipped time", "30 2 * * *", ny, utc(2024, 3, 10, 5, 0), utc(2024, 3, 11, 6, 30)},
+		{"spring forward hourly", "0 * * * *", ny, utc(2024, 3, 10, 6, 0), utc(2024, 3, 10, 7, 0)},
+		{"spring forward minutes", "*/30 * * * *", ny, utc(2024, 3, 10, 6, 30), utc(2024, 3, 10, 7, 0)},
+		{"spring forward daily", "0 3 * * *", ny, utc(2024, 3, 10, 5, 0), utc(2024, 3, 10, 7, 0)},
+
+		// 2024-11-03 02:00 EDT becomes 01:00 EST
+		{"fall back first hour", "0 * * * *", ny, utc(2024, 11, 3, 5, 0), utc(2024, 11, 3, 6, 0)},
+		{"fall back second hour", "0 * * * *", ny, utc(2024, 11, 3, 6, 0), utc(2024, 11, 3, 7, 0)},
+		{"fall back minute", "* * * * *", ny, utc(2024, 11, 3, 5, 59), utc(2024, 11, 3, 6, 0)},
+		{"fall back repeated time", "30 1 * * *", ny, utc(2024, 11, 3, 5, 45), utc(2024, 11, 3, 6, 30)},
+		{"fall back after repeat", "30 1 * * *", ny, utc(2024, 11, 3, 6, 30), utc(2024, 11, 4, 6, 30)},
+		{"fall back daily", "0 2 * * *", ny, utc(2024, 11, 3, 4, 0), utc(2024, 11, 3, 7, 0)},
+
+		// 2026-09-06 00:00 -04 becomes 01:00 -03, so the day has no midnight
+		{"skipped midnight next day", "0 12 * * 0", scl, utc(2026, 9, 5, 14, 0), utc(2026, 9, 6, 15, 0)},
+		{"skipped midnight hour check", "0 1 * * 6", scl, utc(2026, 9, 6, 2, 30), utc(2026, 9, 12, 4, 0)},
+		{"skipped midnight daily", "0 0 * * *", scl, utc(2026, 9, 5, 16, 0), utc(2026, 9, 7, 3, 0)},
+		{"skipped midnight hourly", "30 * * * *", scl, utc(2026, 9, 6, 3, 30), utc(2026, 9, 6, 4, 30)},
+		{"skipped midnight first hour", "0 * * * 0", scl, utc(2026, 9, 6, 0, 0), utc(2026, 9, 6, 4, 0)},
+
+		// 2026-04-05 00:00 -03 becomes 2026-04-04 23:00 -04
+		{"repeated hour before midnight", "0 0 * * *", scl, utc(2026, 4, 4, 15, 0), utc(2026, 4, 5, 4, 0)},
+		{"repeated hour twice", "0 23 * * 6", scl, utc(2026, 4, 5, 2, 0), utc(2026, 4, 5, 3, 0)},
+		{"repeated hour next day", "0 12 * * 0", scl, utc(2026, 4, 5, 1, 0), utc(2026, 4, 5, 16, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec, tt.loc)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			got := s.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from.In(tt.loc), got, tt.want.In(tt.loc))
+			}
+			if !got.IsZero() && !got.After(tt.from) {
+				t.Errorf("Next(%v) = %v, not after it", tt.from, got)
+			}
+		})
+	}
+}
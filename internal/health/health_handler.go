@@ -6,10 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	srverrors "andy.dev/srv/errors"
 	"andy.dev/srv/log"
+	"github.com/alexedwards/flow"
+	"github.com/go-kit/kit/metrics"
 )
 
 const (
@@ -23,15 +27,59 @@ var (
 	errClosed  = errors.New("handler was closed")
 )
 
+// The states of a check.
+const (
+	stateNotRun  = "not_yet_run"
+	statePassing = "passing"
+	// failing checks have failed fewer than MaxFailures times in a row.
+	stateFailing = "failing"
+	stateFailed  = "failed"
+)
+
 type checkStatus struct {
+	// Timestamp is the time of the last run, which is zero if the check has
+	// not yet run.
 	Timestamp   time.Time `json:"timestamp"`
+	State       string    `json:"state"`
 	Err         error     `json:"err"`
+	Failed      bool      `json:"failed"`
+	Critical    bool      `json:"critical"`
 	Failures    int       `json:"failures"`
 	MaxFailures int       `json:"max_failures_allowed"`
+	// Successes counts consecutive successes while failed, towards the
+	// RecoverAfter needed to recover. A RecoverAfter of 0 means that the check
+	// stays failed.
+	Successes    int `json:"successes"`
+	RecoverAfter int `json:"recover_after"`
+	// runMu ensures that a check triggered on demand doesn't run at the same
+	// time as its scheduled run.
+	runMu sync.Mutex
+}
+
+// MarshalJSON reports the error of a check as its message.
+func (cs *checkStatus) MarshalJSON() ([]byte, error) {
+	type status checkStatus
+	var errMsg string
+	if cs.Err != nil {
+		errMsg = cs.Err.Error()
+	}
+	return json.Marshal(struct {
+		*status
+		Err string `json:"err,omitempty"`
+	}{(*status)(cs), errMsg})
 }
 
 type CheckFn func(context.Context, *log.Logger) error
 
+// Metrics are reported for each check, with a "check" label holding its ID.
+type Metrics struct {
+	// Status is 1 while the check is passing, and 0 once it has failed.
+	Status              metrics.Gauge
+	ConsecutiveFailures metrics.Gauge
+	Duration            metrics.Histogram
+	Failures            metrics.Counter
+}
+
 type Handler struct {
 	ctx     context.Context
 	cancel  context.CancelCauseFunc
@@ -40,15 +88,22 @@ type Handler struct {
 	checks  []*HealthCheck
 	status  map[string]*checkStatus
 	started bool
+	// checks in a persistent handler recover after a single success by
+	// default, rather than staying failed.
+	persistent bool
+	failCode   int
+	onPanic    func(checkID string, err error)
+	metrics    *Metrics
 }
 
 func NewHandler(ctx context.Context) *Handler {
 	hctx, ccf := context.WithCancelCause(ctx)
 	return &Handler{
-		ctx:    hctx,
-		cancel: ccf,
-		checks: []*HealthCheck{},
-		status: map[string]*checkStatus{},
+		ctx:      hctx,
+		cancel:   ccf,
+		checks:   []*HealthCheck{},
+		status:   map[string]*checkStatus{},
+		failCode: http.StatusInternalServerError,
 	}
 }
 
@@ -62,39 +117,63 @@ func (h *Handler) Start(logger *log.Logger) {
 	h.started = true
 	for i := range h.checks {
 		check := h.checks[i]
+		recoverAfter := check.RecoverAfter
+		if recoverAfter == 0 && h.persistent {
+			recoverAfter = 1
+		}
 		h.status[check.ID] = &checkStatus{
-			Timestamp:   time.Now(),
-			Err:         nil,
-			Failures:    0,
-			MaxFailures: check.MaxFailures,
+			State:        stateNotRun,
+			Err:          nil,
+			Failures:     0,
+			MaxFailures:  check.MaxFailures,
+			RecoverAfter: recoverAfter,
+			Critical:     !check.NonCritical,
 		}
 		go h.dispatcher(check.ID, check.Fn, check.Interval, check.Timeout)
 	}
 }
 
+// OnPanic sets a function to be called when a check panics, in addition to
+// the check being failed.
+func (h *Handler) OnPanic(fn func(checkID string, err error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onPanic = fn
+}
+
+// SetMetrics sets the metrics reported for each check. It must be called
+// before [Handler.Start].
+func (h *Handler) SetMetrics(m Metrics) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.metrics = &m
+}
+
 func (h *Handler) AddCheck(check *HealthCheck) error {
 	select {
 	case <-h.ctx.Done():
 		return errClosed
 	default:
 	}
-	if check.Interval <= check.Timeout {
-		return fmt.Errorf("interval must be greater than timeout")
-	}
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if _, found := h.status[check.ID]; found {
-		return fmt.Errorf("duplicate health check name")
-	}
 	if check.Interval <= 0 {
 		check.Interval = defaultInterval
 	}
 	if check.Timeout <= 0 {
 		check.Timeout = defaultTimeout
 	}
-	if check.MaxFailures < 0 {
+	if check.MaxFailures <= 0 {
 		check.MaxFailures = 1
 	}
+	if check.Interval <= check.Timeout {
+		return fmt.Errorf("interval must be greater than timeout")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.checks {
+		if c.ID == check.ID {
+			return fmt.Errorf("duplicate health check name")
+		}
+	}
 	h.checks = append(h.checks, check)
 	return nil
 }
@@ -104,19 +183,26 @@ func (h *Handler) SetFailed(msg string) {
 	defer h.mu.Unlock()
 	h.status["srv"] = &checkStatus{
 		Timestamp:   time.Now(),
+		State:       stateFailed,
 		Err:         fmt.Errorf(msg),
+		Failed:      true,
+		Critical:    true,
 		Failures:    1,
 		MaxFailures: 1,
 	}
 }
 
 func (h *Handler) dispatcher(checkID string, fn CheckFn, interval, timeout time.Duration) {
+	// run once straight away, so that the status is known from the start.
+	if stop := h.runCheck(checkID, fn, timeout); stop {
+		return
+	}
 	t := time.NewTicker(interval)
 	defer t.Stop()
 	for {
 		select {
 		case <-t.C:
-			if failed := h.runCheck(checkID, fn, timeout); failed {
+			if stop := h.runCheck(checkID, fn, timeout); stop {
 				return
 			}
 		case <-h.ctx.Done():
@@ -125,11 +211,35 @@ func (h *Handler) dispatcher(checkID string, fn CheckFn, interval, timeout time.
 	}
 }
 
-func (h *Handler) runCheck(checkID string, fn CheckFn, timeout time.Duration) (failed bool) {
+// runCheck runs a check and updates its status, returning whether the check
+// should stop being run, either because it has failed for good or because the
+// handler has been closed.
+func (h *Handler) runCheck(checkID string, fn CheckFn, timeout time.Duration) (stop bool) {
+	h.mu.RLock()
+	runMu := &h.status[checkID].runMu
+	h.mu.RUnlock()
+	runMu.Lock()
+	defer runMu.Unlock()
+
 	ctx, cf := context.WithTimeoutCause(h.ctx, timeout, errTimeout)
 	defer cf()
+	start := time.Now()
 	res := make(chan error, 1)
 	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				err := srverrors.Recovered(v)
+				h.mu.RLock()
+				onPanic := h.onPanic
+				h.mu.RUnlock()
+				if onPanic != nil {
+					onPanic(checkID, err)
+				} else {
+					h.logger.Error("health check panicked", err, "healthcheck_id", checkID)
+				}
+				res <- err
+			}
+		}()
 		res <- fn(ctx, h.logger)
 	}()
 
@@ -159,22 +269,156 @@ func (h *Handler) runCheck(checkID string, fn CheckFn, timeout time.Duration) (f
 	status := h.status[checkID]
 	status.Timestamp = time.Now()
 	status.Err = result
+	defer h.recordMetrics(checkID, status, result, status.Timestamp.Sub(start))
+
+	defer func() {
+		switch {
+		case status.Failed:
+			status.State = stateFailed
+		case result != nil:
+			status.State = stateFailing
+		default:
+			status.State = statePassing
+		}
+	}()
 
 	if result == nil {
-		if status.Failures > 0 {
-			h.logger.Debug("health check has recovered", "healthcheck_id", checkID)
+		if !status.Failed {
+			status.Failures = 0
+			return false
+		}
+		if status.RecoverAfter == 0 {
+			// a check run on demand can't recover a failed check which
+			// doesn't allow it.
+			return true
 		}
+		status.Successes++
+		if status.Successes < status.RecoverAfter {
+			h.logger.Debug("health check succeeded, recovering", "healthcheck_id", checkID, "successes", status.Successes, "recover_after", status.RecoverAfter)
+			return false
+		}
+		status.Failed = false
 		status.Failures = 0
+		status.Successes = 0
+		h.logger.Info("health check has recovered", "healthcheck_id", checkID)
 		return false
 	}
 
+	status.Successes = 0
 	status.Failures++
-	if status.Failures >= status.MaxFailures {
-		h.logger.Error("health check has failed, service is unhealthy", "healthcheck_id", checkID)
-		return true
+	switch {
+	case status.Failed:
+		// still failed, and may yet recover.
+	case status.Failures >= status.MaxFailures:
+		status.Failed = true
+		switch {
+		case h.persistent:
+			h.logger.Warn("check has failed", "healthcheck_id", checkID)
+		case !status.Critical:
+			h.logger.Warn("non-critical health check has failed, service is degraded", "healthcheck_id", checkID)
+		default:
+			h.logger.Error("health check has failed, service is unhealthy", "healthcheck_id", checkID)
+		}
+	default:
+		h.logger.Warn("health check has failed", "healthcheck_id", checkID, "num_failures", status.Failures, "max_failures", status.MaxFailures)
+	}
+	// a check which can't recover doesn't need to be run again.
+	return status.Failed && status.RecoverAfter == 0
+}
+
+// Failing returns the IDs of all critical checks which have failed, sorted by
+// ID.
+func (h *Handler) Failing() []string {
+	return h.failed(true)
+}
+
+// Degraded returns the IDs of all non-critical checks which have failed,
+// sorted by ID.
+func (h *Handler) Degraded() []string {
+	return h.failed(false)
+}
+
+// Pending returns the IDs of all critical checks which have not yet run,
+// sorted by ID.
+func (h *Handler) Pending() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var pending []string
+	for id, c := range h.status {
+		if c.State == stateNotRun && c.Critical {
+			pending = append(pending, id)
+		}
 	}
-	h.logger.Warn("health check has failed", "healthcheck_id", checkID, "num_failures", status.Failures, "max_failures", status.MaxFailures)
-	return false
+	sort.Strings(pending)
+	return pending
+}
+
+func (h *Handler) failed(critical bool) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var failed []string
+	for id, c := range h.status {
+		if c.Failed && c.Critical == critical {
+			failed = append(failed, id)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// Run runs the check with the given ID immediately, regardless of its
+// schedule, and writes its updated status. The response code is that of the
+// check's run, rather than the status of the whole handler.
+func (h *Handler) Run(w http.ResponseWriter, r *http.Request) {
+	checkID := flow.Param(r.Context(), "check")
+	var check *HealthCheck
+	h.mu.RLock()
+	started := h.started
+	for _, c := range h.checks {
+		if c.ID == checkID {
+			check = c
+		}
+	}
+	h.mu.RUnlock()
+	switch {
+	case check == nil:
+		http.Error(w, "no such check", http.StatusNotFound)
+		return
+	case !started || h.ctx.Err() != nil:
+		http.Error(w, "checks are not running", http.StatusServiceUnavailable)
+		return
+	}
+	h.runCheck(checkID, check.Fn, check.Timeout)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status := h.status[checkID]
+	code := http.StatusOK
+	if status.Err != nil {
+		code = h.failCode
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// recordMetrics records the result of a check run, once its status has been
+// updated.
+// must be called with h.mu held.
+func (h *Handler) recordMetrics(checkID string, status *checkStatus, result error, duration time.Duration) {
+	if h.metrics == nil {
+		return
+	}
+	h.metrics.Duration.With("check", checkID).Observe(duration.Seconds())
+	if result != nil {
+		h.metrics.Failures.With("check", checkID).Add(1)
+	}
+	passing := 1.0
+	if status.Failed {
+		passing = 0
+	}
+	h.metrics.Status.With("check", checkID).Set(passing)
+	h.metrics.ConsecutiveFailures.With("check", checkID).Set(float64(status.Failures))
 }
 
 func (h *Handler) Close() {
@@ -182,6 +426,14 @@ func (h *Handler) Close() {
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.writeStatus(w, r, "")
+}
+
+// writeStatus writes the status of all checks. If failMsg is non-empty, the
+// status is considered failed regardless of the state of the checks. If only
+// non-critical checks have failed, the status is DEGRADED, which is still
+// successful.
+func (h *Handler) writeStatus(w http.ResponseWriter, r *http.Request, failMsg string) {
 	type allChecks struct {
 		Checks map[string]*checkStatus `json:"checks"`
 		Status string                  `json:"status"`
@@ -191,13 +443,27 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	code := http.StatusOK
 	statusMsg := "OK"
 	verbose := r.URL.Query().Has("verbose")
-	for _, c := range h.status {
-		if c.Failures >= c.MaxFailures {
-			code = http.StatusInternalServerError
-			statusMsg = "NOT_OK"
-			break
+	if failMsg == "" {
+		for _, c := range h.status {
+			switch {
+			case c.State == stateNotRun:
+				// readiness checks must pass before the service is ready.
+				if h.persistent && c.Critical && failMsg == "" {
+					failMsg = "NOT_YET_RUN"
+				}
+			case !c.Failed:
+				// healthy
+			case c.Critical:
+				failMsg = "NOT_OK"
+			default:
+				statusMsg = "DEGRADED"
+			}
 		}
 	}
+	if failMsg != "" {
+		code = h.failCode
+		statusMsg = failMsg
+	}
 	w.WriteHeader(code)
 	if !verbose {
 		w.Write([]byte(statusMsg))
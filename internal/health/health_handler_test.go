@@ -0,0 +1,316 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"andy.dev/srv/log"
+	"github.com/alexedwards/flow"
+)
+
+var errCheck = errors.New("check failed")
+
+// script is a check which returns each of its results in turn, repeating the
+// last one.
+type script struct {
+	mu      sync.Mutex
+	results []error
+}
+
+func (s *script) check(context.Context, *log.Logger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.results[0]
+	if len(s.results) > 1 {
+		s.results = s.results[1:]
+	}
+	return err
+}
+
+func testLogger() *log.Logger {
+	return log.NewLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// addCheck adds a check which is only run once by its schedule, when the
+// handler starts.
+func addCheck(t *testing.T, h *Handler, check *HealthCheck) {
+	t.Helper()
+	check.Interval = time.Hour
+	if err := h.AddCheck(check); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitRun waits for the first run of a check.
+func waitRun(t *testing.T, h *Handler, checkID string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		h.mu.RLock()
+		ran := !h.status[checkID].Timestamp.IsZero()
+		h.mu.RUnlock()
+		if ran {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("check %s did not run", checkID)
+}
+
+func serve(h http.Handler) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Code, w.Body.String()
+}
+
+// runRoute returns a router which runs checks on demand.
+func runRoute(h *Handler) http.Handler {
+	mux := flow.New()
+	mux.Handle("/checks/:check/run", http.HandlerFunc(h.Run), "POST")
+	return mux
+}
+
+// run runs a check on demand, returning the response code and the state of
+// the check.
+func run(t *testing.T, mux http.Handler, checkID string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/checks/"+checkID+"/run", nil))
+	var status struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("run %s: %d %q: %v", checkID, w.Code, w.Body, err)
+	}
+	return w.Code, status.State
+}
+
+func TestRecoverAfter(t *testing.T) {
+	type step struct {
+		// the result of the on-demand run, and the response code, state of
+		// the check, and status expected after it.
+		result    error
+		code      int
+		state     string
+		wantCode  int
+		wantState string
+	}
+	tests := []struct {
+		name         string
+		readiness    bool
+		maxFailures  int
+		recoverAfter int
+		// first is the result of the scheduled run when the handler starts.
+		first error
+		steps []step
+	}{
+		{
+			name:         "recovers after successes in a row",
+			recoverAfter: 2,
+			first:        errCheck,
+			steps: []step{
+				{nil, 200, stateFailed, 500, "NOT_OK"},
+				{errCheck, 500, stateFailed, 500, "NOT_OK"},
+				{nil, 200, stateFailed, 500, "NOT_OK"},
+				{nil, 200, statePassing, 200, "OK"},
+				{errCheck, 500, stateFailed, 500, "NOT_OK"},
+			},
+		},
+		{
+			name:         "fails after max failures",
+			maxFailures:  2,
+			recoverAfter: 1,
+			first:        errCheck,
+			steps: []step{
+				{nil, 200, statePassing, 200, "OK"},
+				{errCheck, 500, stateFailing, 200, "OK"},
+				{errCheck, 500, stateFailed, 500, "NOT_OK"},
+				{nil, 200, statePassing, 200, "OK"},
+			},
+		},
+		{
+			name:  "latched",
+			first: errCheck,
+			steps: []step{
+				{nil, 200, stateFailed, 500, "NOT_OK"},
+				{nil, 200, stateFailed, 500, "NOT_OK"},
+			},
+		},
+		{
+			name:      "readiness recovers by default",
+			readiness: true,
+			first:     errCheck,
+			steps: []step{
+				{nil, 200, statePassing, 200, "OK"},
+				{errCheck, 503, stateFailed, 503, "NOT_OK"},
+				{nil, 200, statePassing, 200, "OK"},
+			},
+		},
+		{
+			name:         "readiness recovers after successes in a row",
+			readiness:    true,
+			recoverAfter: 3,
+			first:        errCheck,
+			steps: []step{
+				{nil, 200, stateFailed, 503, "NOT_OK"},
+				{nil, 200, stateFailed, 503, "NOT_OK"},
+				{nil, 200, statePassing, 200, "OK"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, status := NewHandler(context.Background()), http.Handler(nil)
+			if tt.readiness {
+				rh := NewReadinessHandler(context.Background())
+				rh.SetStarted()
+				h, status = rh.Handler, rh
+			} else {
+				status = h
+			}
+			defer h.Close()
+			s := &script{results: []error{tt.first}}
+			addCheck(t, h, &HealthCheck{ID: "db", Fn: s.check, MaxFailures: tt.maxFailures, RecoverAfter: tt.recoverAfter})
+			h.Start(testLogger())
+			waitRun(t, h, "db")
+			mux := runRoute(h)
+			for i, step := range tt.steps {
+				s.mu.Lock()
+				s.results = []error{step.result}
+				s.mu.Unlock()
+				if code, state := run(t, mux, "db"); code != step.code || state != step.state {
+					t.Errorf("step %d: run returned %d %s, want %d %s", i, code, state, step.code, step.state)
+				}
+				if code, body := serve(status); code != step.wantCode || body != step.wantState {
+					t.Errorf("step %d: status is %d %s, want %d %s", i, code, body, step.wantCode, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestDegraded(t *testing.T) {
+	tests := []struct {
+		name         string
+		readiness    bool
+		critical     error
+		nonCritical  error
+		wantCode     int
+		wantStatus   string
+		wantDegraded []string
+	}{
+		{"passing", false, nil, nil, 200, "OK", nil},
+		{"degraded", false, nil, errCheck, 200, "DEGRADED", []string{"cache"}},
+		{"failed", false, errCheck, nil, 500, "NOT_OK", nil},
+		{"failed and degraded", false, errCheck, errCheck, 500, "NOT_OK", []string{"cache"}},
+		{"degraded readiness", true, nil, errCheck, 200, "DEGRADED", []string{"cache"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, status := NewHandler(context.Background()), http.Handler(nil)
+			if tt.readiness {
+				rh := NewReadinessHandler(context.Background())
+				rh.SetStarted()
+				h, status = rh.Handler, rh
+			} else {
+				status = h
+			}
+			defer h.Close()
+			critical := &script{results: []error{tt.critical}}
+			nonCritical := &script{results: []error{tt.nonCritical}}
+			addCheck(t, h, &HealthCheck{ID: "db", Fn: critical.check})
+			addCheck(t, h, &HealthCheck{ID: "cache", Fn: nonCritical.check, NonCritical: true})
+			h.Start(testLogger())
+			waitRun(t, h, "db")
+			waitRun(t, h, "cache")
+			if code, body := serve(status); code != tt.wantCode || body != tt.wantStatus {
+				t.Errorf("status is %d %s, want %d %s", code, body, tt.wantCode, tt.wantStatus)
+			}
+			if got := h.Degraded(); strings.Join(got, ",") != strings.Join(tt.wantDegraded, ",") {
+				t.Errorf("Degraded() = %v, want %v", got, tt.wantDegraded)
+			}
+		})
+	}
+}
+
+func TestNotYetRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		readiness   bool
+		nonCritical bool
+		wantCode    int
+		wantStatus  string
+	}{
+		{"readiness", true, false, 503, "NOT_YET_RUN"},
+		{"non-critical readiness", true, true, 200, "OK"},
+		{"health", false, false, 200, "OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, status := NewHandler(context.Background()), http.Handler(nil)
+			var rh *ReadinessHandler
+			if tt.readiness {
+				rh = NewReadinessHandler(context.Background())
+				rh.SetStarted()
+				h, status = rh.Handler, rh
+			} else {
+				status = h
+			}
+			defer h.Close()
+			release := make(chan struct{})
+			addCheck(t, h, &HealthCheck{ID: "db", NonCritical: tt.nonCritical, Fn: func(context.Context, *log.Logger) error {
+				<-release
+				return nil
+			}})
+			h.Start(testLogger())
+			if code, body := serve(status); code != tt.wantCode || body != tt.wantStatus {
+				t.Errorf("status before first run is %d %s, want %d %s", code, body, tt.wantCode, tt.wantStatus)
+			}
+			if rh != nil && rh.Ready() == (tt.wantCode != 200) {
+				t.Errorf("Ready() = %t before first run", rh.Ready())
+			}
+			close(release)
+			waitRun(t, h, "db")
+			if code, body := serve(status); code != 200 || body != "OK" {
+				t.Errorf("status after first run is %d %s, want 200 OK", code, body)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	h := NewHandler(context.Background())
+	s := &script{results: []error{nil}}
+	addCheck(t, h, &HealthCheck{ID: "db", Fn: s.check})
+	mux := runRoute(h)
+	post := func(checkID string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/checks/"+checkID+"/run", nil))
+		return w.Code
+	}
+
+	if code := post("db"); code != http.StatusServiceUnavailable {
+		t.Errorf("run before start returned %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	h.Start(testLogger())
+	waitRun(t, h, "db")
+	if code := post("unknown"); code != http.StatusNotFound {
+		t.Errorf("run of unknown check returned %d, want %d", code, http.StatusNotFound)
+	}
+	if code, state := run(t, mux, "db"); code != http.StatusOK || state != statePassing {
+		t.Errorf("run returned %d %s, want %d %s", code, state, http.StatusOK, statePassing)
+	}
+	h.Close()
+	if code := post("db"); code != http.StatusServiceUnavailable {
+		t.Errorf("run after close returned %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
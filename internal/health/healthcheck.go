@@ -13,4 +13,11 @@ type HealthCheck struct {
 	Interval    time.Duration
 	Timeout     time.Duration
 	MaxFailures int
+	// RecoverAfter is the number of consecutive successes after which a failed
+	// check becomes healthy again. If 0, a failed check stays failed, unless
+	// it belongs to a readiness handler, in which case it is 1.
+	RecoverAfter int
+	// NonCritical checks only degrade the service when they fail, rather than
+	// failing it.
+	NonCritical bool
 }
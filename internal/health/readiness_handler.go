@@ -1,10 +1,95 @@
 package health
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
 
-// NewReadinessHandler returns a handler that, if you can reach it says that everything is hunky-dory.
-func NewReadinessHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.Write([]byte("OK"))
-	})
+// ReadinessHandler reports readiness based on a set of checks which, unlike
+// health checks, keep running after they fail and recover once they succeed.
+// It will report as not ready until [ReadinessHandler.Start] has been called,
+// while readiness has been set to false with [ReadinessHandler.SetReady], and
+// once [ReadinessHandler.SetDraining] or [ReadinessHandler.Stop] has been
+// called. It will also report as not ready while held with
+// [ReadinessHandler.Hold].
+type ReadinessHandler struct {
+	*Handler
+	started  atomic.Bool
+	ready    atomic.Bool
+	draining atomic.Bool
+	stopped  atomic.Bool
+	held     atomic.Bool
+}
+
+// NewReadinessHandler returns a new readiness handler. Readiness is set to true
+// by default.
+func NewReadinessHandler(ctx context.Context) *ReadinessHandler {
+	h := NewHandler(ctx)
+	h.persistent = true
+	h.failCode = http.StatusServiceUnavailable
+	rh := &ReadinessHandler{Handler: h}
+	rh.ready.Store(true)
+	return rh
+}
+
+// SetStarted marks the service as started, allowing it to report ready.
+func (rh *ReadinessHandler) SetStarted() {
+	rh.started.Store(true)
+}
+
+// SetReady sets whether the service considers itself ready, independent of
+// any checks.
+func (rh *ReadinessHandler) SetReady(ready bool) {
+	rh.ready.Store(ready)
+}
+
+// SetDraining permanently marks the service as not ready, as it is draining
+// before shutdown.
+func (rh *ReadinessHandler) SetDraining() {
+	rh.draining.Store(true)
+}
+
+// Stop permanently marks the service as not ready, as it is shutting down.
+func (rh *ReadinessHandler) Stop() {
+	rh.stopped.Store(true)
+}
+
+// Hold marks the service as not ready until [ReadinessHandler.Release] is
+// called, even if it would otherwise be ready. This is used while another
+// process is handing over to this one.
+func (rh *ReadinessHandler) Hold() {
+	rh.held.Store(true)
+}
+
+// Release undoes [ReadinessHandler.Hold].
+func (rh *ReadinessHandler) Release() {
+	rh.held.Store(false)
+}
+
+// Ready returns whether the service would report ready if it were not held.
+func (rh *ReadinessHandler) Ready() bool {
+	return rh.failMsg() == "" && len(rh.Failing()) == 0 && len(rh.Pending()) == 0
+}
+
+func (rh *ReadinessHandler) failMsg() string {
+	switch {
+	case rh.stopped.Load():
+		return "SHUTTING_DOWN"
+	case rh.draining.Load():
+		return "DRAINING"
+	case !rh.started.Load():
+		return "NOT_STARTED"
+	case !rh.ready.Load():
+		return "NOT_READY"
+	}
+	return ""
+}
+
+func (rh *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	failMsg := rh.failMsg()
+	if failMsg == "" && rh.held.Load() {
+		failMsg = "WAITING_FOR_HANDOVER"
+	}
+	rh.writeStatus(w, r, failMsg)
 }
@@ -0,0 +1,30 @@
+package health
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// StartupHandler responds with 503 Service Unavailable until
+// [StartupHandler.SetStarted] is called, and with 200 OK thereafter.
+type StartupHandler struct {
+	started atomic.Bool
+}
+
+func NewStartupHandler() *StartupHandler {
+	return &StartupHandler{}
+}
+
+// SetStarted marks the service as started.
+func (sh *StartupHandler) SetStarted() {
+	sh.started.Store(true)
+}
+
+func (sh *StartupHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if !sh.started.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("NOT_STARTED"))
+		return
+	}
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,78 @@
+// Package listenfd retrieves listening sockets passed to the process using the
+// socket activation protocol described in sd_listen_fds(3).
+package listenfd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// firstFD is the first file descriptor passed, after stdin, stdout and stderr.
+const firstFD = 3
+
+// Listener is a listener passed to the process, along with the name given to
+// it in $LISTEN_FDNAMES. With systemd, this is set with FileDescriptorName=.
+type Listener struct {
+	Name string
+	net.Listener
+}
+
+// Listeners returns the listeners passed to the process. The environment
+// variables which describe them are unset, so that they are not inherited by
+// any child processes. Any file descriptors which are not listening sockets
+// are closed, and reported in the returned error.
+func Listeners() ([]Listener, error) {
+	pidStr, hasPID := os.LookupEnv("LISTEN_PID")
+	fdsStr := os.Getenv("LISTEN_FDS")
+	namesStr := os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if fdsStr == "" {
+		return nil, nil
+	}
+	// the sockets are meant for a different process, which leaked the
+	// variables to us. A missing $LISTEN_PID is allowed, since the parent
+	// cannot know the PID of a process it is about to exec.
+	if hasPID {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return nil, nil
+		}
+	}
+	n, err := strconv.Atoi(fdsStr)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fdsStr)
+	}
+	var names []string
+	if namesStr != "" {
+		names = strings.Split(namesStr, ":")
+	}
+	var (
+		listeners []Listener
+		errs      []error
+	)
+	for i := 0; i < n; i++ {
+		fd := firstFD + i
+		name := "unknown"
+		if i < len(names) {
+			name = names[i]
+		}
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		// the listener holds its own copy of the descriptor.
+		f.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("file descriptor %d (%s): %w", fd, name, err))
+			continue
+		}
+		listeners = append(listeners, Listener{name, ln})
+	}
+	return listeners, errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+// Package sdnotify implements the systemd service notification protocol
+// described in sd_notify(3), allowing a service to report its state and send
+// watchdog keep-alives to the service manager.
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification states understood by the service manager.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns a STATUS= state, which the service manager displays as the
+// status of the service.
+func Status(msg string) string {
+	// each state is a single line.
+	return "STATUS=" + strings.ReplaceAll(msg, "\n", " ")
+}
+
+// MainPID returns a MAINPID= state, which tells the service manager that the
+// main process of the service is now pid.
+func MainPID(pid int) string {
+	return "MAINPID=" + strconv.Itoa(pid)
+}
+
+// Notifier sends notifications to the service manager over a unix datagram
+// socket. A nil Notifier is valid, and discards all notifications.
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// FromEnv returns a Notifier for the socket named by $NOTIFY_SOCKET, or nil if
+// it is not set, which is the case when the service was not started by
+// systemd with Type=notify.
+func FromEnv() *Notifier {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	return New(path)
+}
+
+// New returns a Notifier for the socket at path. A path beginning with "@"
+// refers to a socket in the abstract namespace, which the net package handles
+// for us.
+func New(path string) *Notifier {
+	return &Notifier{
+		addr: &net.UnixAddr{Name: path, Net: "unixgram"},
+	}
+}
+
+// Notify sends the given states to the service manager in a single datagram.
+func (n *Notifier) Notify(states ...string) error {
+	if n == nil || len(states) == 0 {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return fmt.Errorf("failed to notify: %w", err)
+	}
+	return nil
+}
+
+// WatchdogInterval returns the interval within which the service manager
+// expects to receive WATCHDOG=1, as set by $WATCHDOG_USEC, or 0 if the
+// watchdog is not enabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	// $WATCHDOG_PID is set when the variables may have been inherited by a
+	// process other than the one being watched.
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+	return time.Duration(usec) * time.Microsecond
+}
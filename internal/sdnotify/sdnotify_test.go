@@ -0,0 +1,107 @@
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name string
+		path func(t *testing.T) string
+	}{
+		{"path", func(t *testing.T) string {
+			return filepath.Join(t.TempDir(), "notify.sock")
+		}},
+		{"abstract", func(t *testing.T) string {
+			return fmt.Sprintf("@sdnotify-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path(t)
+			conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			t.Setenv("NOTIFY_SOCKET", path)
+
+			n := FromEnv()
+			if n == nil {
+				t.Fatal("FromEnv returned nil with NOTIFY_SOCKET set")
+			}
+			for _, states := range [][]string{
+				{Ready, Status("serving\nrequests")},
+				{Stopping},
+				{Watchdog},
+			} {
+				if err := n.Notify(states...); err != nil {
+					t.Fatalf("Notify(%q): %v", states, err)
+				}
+				want := states[0]
+				for _, s := range states[1:] {
+					want += "\n" + s
+				}
+				if got := read(t, conn); got != want {
+					t.Errorf("received %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyUnset(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n := FromEnv()
+	if n != nil {
+		t.Fatal("FromEnv returned a Notifier with NOTIFY_SOCKET unset")
+	}
+	if err := n.Notify(Ready); err != nil {
+		t.Errorf("nil Notifier returned %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"unset", "", "", 0},
+		{"invalid", "soon", "", 0},
+		{"zero", "0", "", 0},
+		{"no pid", "30000000", "", 30 * time.Second},
+		{"this process", "30000000", pid, 30 * time.Second},
+		{"other process", "30000000", "1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := WatchdogInterval(); got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func read(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
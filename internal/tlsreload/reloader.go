@@ -0,0 +1,93 @@
+// Package tlsreload provides a TLS certificate source which reloads the
+// certificate and key from disk when they change.
+package tlsreload
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"andy.dev/srv/log"
+)
+
+// checkInterval is the minimum time between checks for changed files.
+const checkInterval = 10 * time.Second
+
+// Reloader holds a TLS certificate loaded from a pair of files, reloading it
+// when either file is modified.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *log.Logger
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	modTime     time.Time
+	lastChecked time.Time
+}
+
+// New loads the certificate and key from the given files, returning an error
+// if they cannot be loaded.
+func New(certFile, keyFile string, logger *log.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	modTime, err := r.newestModTime()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.lastChecked = time.Now()
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the
+// files have changed. It is suitable for use as [tls.Config.GetCertificate].
+// If the files cannot be reloaded, the previous certificate is kept.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastChecked) < checkInterval {
+		return r.cert, nil
+	}
+	r.lastChecked = time.Now()
+	modTime, err := r.newestModTime()
+	if err != nil {
+		r.logger.Warn("could not check TLS certificate for changes", err)
+		return r.cert, nil
+	}
+	if !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		r.logger.Warn("could not reload TLS certificate, keeping previous certificate", err)
+		return r.cert, nil
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.logger.Info("reloaded TLS certificate", "cert_file", r.certFile)
+	return r.cert, nil
+}
+
+func (r *Reloader) newestModTime() (time.Time, error) {
+	var newest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	return newest, nil
+}
@@ -1,6 +1,18 @@
 package srv
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"andy.dev/srv/errors"
+	"andy.dev/srv/log"
+)
 
 // JobFn is a job to be run at startup. The service will run until either a
 // single job has registered an error or until all jobs have completed
@@ -23,3 +35,271 @@ func Job[T any](fn func(context.Context, *Logger, T) error, arg T) JobFn {
 		return fn(ctx, logger, arg)
 	}
 }
+
+var errShuttingDown = errors.New("service is shutting down")
+
+type jobState string
+
+const (
+	jobPending    jobState = "pending"
+	jobRunning    jobState = "running"
+	jobRestarting jobState = "restarting"
+	jobCompleted  jobState = "completed"
+	jobFailed     jobState = "failed"
+)
+
+// jobEntry is a job registered with the service, along with everything needed
+// to run and report on it.
+type jobEntry struct {
+	name     string
+	fn       JobFn
+	logger   *Logger
+	location log.CodeLocation
+	restart  *restartPolicy
+
+	mu       sync.Mutex
+	state    jobState
+	started  time.Time
+	finished time.Time
+	lastErr  error
+	restarts int
+}
+
+// newJobEntry creates a job entry. Jobs are named in the order they are
+// registered, starting with "job-1", and skipping any name already given to a
+// named job.
+// must be called with s.mu held.
+func (s *Service) newJobEntry(fn JobFn, location log.CodeLocation) *jobEntry {
+	n := len(s.jobs) + 1
+	for s.validJobName("job-"+strconv.Itoa(n)) != nil {
+		n++
+	}
+	return &jobEntry{
+		name:     "job-" + strconv.Itoa(n),
+		fn:       fn,
+		location: location,
+		state:    jobPending,
+	}
+}
+
+// AddNamedJob adds a job like [AddJob], but gives it a name. The job will be
+// supplied with its own logger created with [NewLogger], so that its level can
+// be adjusted independently at runtime, and the name will be used to label the
+// job's metrics and its samples in CPU profiles taken from
+// /debug/pprof/profile. The name must not already be used by another job or
+// logger.
+func AddNamedJob(name string, job JobFn) {
+	std.addNamedJob(log.Up(1), name, job)
+}
+
+// AddNamedJob adds a named job to the service. See [AddNamedJob].
+func (s *Service) AddNamedJob(name string, job JobFn) {
+	s.addNamedJob(log.Up(1), name, job)
+}
+
+func (s *Service) addNamedJob(caller log.CodeLocation, name string, job JobFn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, err := s.newNamedJobEntry(caller, name, job)
+	if err != nil {
+		s.fatal(caller, "AddNamedJob():", err)
+		return
+	}
+	s.addJobEntry(caller, entry)
+}
+
+// Go starts a named job while the service is running, such as a consumer for
+// a tenant discovered at runtime. The job is treated like one added before
+// [Serve]: it is shown at the /jobs route, its failure will shut down the
+// service, and the service will not shut down for lack of jobs until it has
+// completed. Job names must be unique, including those of jobs which have
+// completed, and must not be used by a logger.
+//
+// If called before Serve, the job is added like [AddNamedJob], and will be
+// started along with the others. Once the service has begun shutting down, Go
+// returns an error and the job is not run.
+func Go(name string, job JobFn) error {
+	return std.goJob(log.Up(1), name, job)
+}
+
+// Go starts a named job while the service is running. See [Go].
+func (s *Service) Go(name string, job JobFn) error {
+	return s.goJob(log.Up(1), name, job)
+}
+
+func (s *Service) goJob(caller log.CodeLocation, name string, job JobFn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return errShuttingDown
+	}
+	entry, err := s.newNamedJobEntry(caller, name, job)
+	if err != nil {
+		return err
+	}
+	s.addJobEntry(caller, entry)
+	return nil
+}
+
+// newNamedJobEntry creates the entry for a named job, along with its logger,
+// which shares its name.
+// must be called with s.mu held.
+func (s *Service) newNamedJobEntry(caller log.CodeLocation, name string, job JobFn) (*jobEntry, error) {
+	if err := s.validJobName(name); err != nil {
+		return nil, err
+	}
+	entry := s.newJobEntry(job, caller)
+	entry.name = name
+	rootLevel, _ := s.logHandler.GetLevel()
+	logger, err := s.addLogger(caller, name, rootLevel, LogLocation)
+	if err != nil {
+		return nil, fmt.Errorf("job name %s is already used by a logger", name)
+	}
+	entry.logger = logger
+	return entry, nil
+}
+
+// addJobEntry adds a job to the service, starting it immediately if the
+// service is already running jobs.
+// must be called with s.mu held.
+func (s *Service) addJobEntry(caller log.CodeLocation, entry *jobEntry) {
+	if s.stopping {
+		s.logWarn(caller, "service is shutting down, job will not be run", "job", entry.name)
+		return
+	}
+	s.jobs = append(s.jobs, entry)
+	if s.jobsStarted {
+		s.startJob(entry)
+	}
+}
+
+// validJobName ensures a job name is non-empty and not already in use.
+// must be called with s.mu held.
+func (s *Service) validJobName(name string) error {
+	if name == "" {
+		return fmt.Errorf("job name cannot be empty")
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("duplicate job name: %s", name)
+		}
+	}
+	return nil
+}
+
+// run runs the job with its own logger, if it has one, labeling it for
+// profiling and tracking its state in the job_running and job_exit_status
+// metrics.
+func (j *jobEntry) run(ctx context.Context, logger *Logger, m *srvMetrics) (err error) {
+	if j.logger != nil {
+		logger = j.logger
+	}
+	j.setState(jobRunning, nil)
+	m.jobRunning.With("job", j.name).Set(1)
+	defer func() {
+		m.jobRunning.With("job", j.name).Set(0)
+		if err != nil {
+			j.setState(jobFailed, err)
+			m.jobExitStatus.With("job", j.name).Set(1)
+		} else {
+			j.setState(jobCompleted, nil)
+			m.jobExitStatus.With("job", j.name).Set(0)
+		}
+	}()
+	pprof.Do(ctx, pprof.Labels("job", j.name), func(ctx context.Context) {
+		if j.restart != nil {
+			err = j.supervise(ctx, logger, m)
+			return
+		}
+		err = j.call(ctx, logger)
+	})
+	return err
+}
+
+// call runs the job function once. If it panics, the panic is logged, written
+// to the termination log and returned as an error, so that the job fails like
+// any other.
+func (j *jobEntry) call(ctx context.Context, logger *Logger) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.Recovered(v)
+			logger.Error("job panicked", err, "job", j.name)
+			termlogWrite(noloc, "job panicked", err, "job", j.name)
+		}
+	}()
+	return j.fn(ctx, logger)
+}
+
+func (j *jobEntry) setState(state jobState, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	switch state {
+	case jobRunning:
+		if j.started.IsZero() {
+			j.started = now
+		}
+	case jobRestarting:
+		j.restarts++
+	case jobCompleted, jobFailed:
+		j.finished = now
+	}
+	if err != nil {
+		j.lastErr = err
+	}
+	j.state = state
+}
+
+type jobStatus struct {
+	Name      string     `json:"name"`
+	State     jobState   `json:"state"`
+	Location  string     `json:"location,omitempty"`
+	Started   *time.Time `json:"started,omitempty"`
+	Elapsed   string     `json:"elapsed,omitempty"`
+	Restarts  int        `json:"restarts,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+func (j *jobEntry) status(verbose bool) jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	js := jobStatus{
+		Name:  j.name,
+		State: j.state,
+	}
+	if !verbose {
+		return js
+	}
+	js.Location = j.location.String()
+	js.Restarts = j.restarts
+	if j.lastErr != nil {
+		js.LastError = j.lastErr.Error()
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		js.Started = &started
+		end := time.Now()
+		if !j.finished.IsZero() {
+			end = j.finished
+		}
+		js.Elapsed = end.Sub(j.started).Round(time.Millisecond).String()
+	}
+	return js
+}
+
+// jobsRoute reports the state of all jobs at the /jobs route. If the verbose
+// query parameter is present, the registration location, start time, elapsed
+// time, restart count and last error of each job are included.
+func (s *Service) jobsRoute(w http.ResponseWriter, r *http.Request) {
+	verbose := r.URL.Query().Has("verbose")
+	s.mu.Lock()
+	jobs := make([]jobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.status(verbose))
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Jobs []jobStatus `json:"jobs"`
+	}{jobs})
+}
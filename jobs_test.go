@@ -0,0 +1,61 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestGoWhileShuttingDown(t *testing.T) {
+	s := newTestService(t)
+	running := make(chan struct{})
+	s.AddJob(func(ctx context.Context, _ *Logger) error {
+		close(running)
+		<-ctx.Done()
+		return nil
+	})
+	var goErr error
+	s.OnEvent(func(e Event) {
+		if e.Type != EventShuttingDown {
+			return
+		}
+		goErr = s.Go("late", func(context.Context, *Logger) error {
+			t.Error("job started while shutting down")
+			return nil
+		})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-running
+		cancel()
+	}()
+	if err := s.Run(ctx); err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+	if !errors.Is(goErr, errShuttingDown) {
+		t.Errorf("Go() = %v, want %v", goErr, errShuttingDown)
+	}
+}
+
+func TestJobNamesUnique(t *testing.T) {
+	s := newTestService(t)
+	job := func(context.Context, *Logger) error { return nil }
+	s.AddJob(job)
+	s.AddNamedJob("job-3", job)
+	s.AddNamedJob("job-4", job)
+	s.AddJob(job)
+	s.AddJob(job)
+	if err := s.err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"job-1", "job-3", "job-4", "job-5", "job-6"}
+	var got []string
+	for _, j := range s.jobs {
+		got = append(got, j.name)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got job names %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	srverrors "andy.dev/srv/errors"
+)
+
+type drainingKey struct{}
+
+// Drain puts the service into drain mode, in which it stops accepting new
+// work before shutting down. The /readyz route will begin to fail, the channel
+// returned by [Draining] will be closed, and after the period set by
+// --drain-period, the service will shut down normally. Drain mode can also be
+// entered with a POST to the /lifecycle/drain route or with any signal set
+// with [DrainSignals]. Calling Drain more than once has no effect.
+func Drain() {
+	std.Drain()
+}
+
+// Drain puts the service into drain mode. See [Drain].
+func (s *Service) Drain() {
+	s.drainOnce.Do(func() {
+		close(s.draining)
+	})
+}
+
+// Draining returns a channel which will be closed when the service enters
+// drain mode. Jobs which accept work should stop doing so when this channel is
+// closed, and finish any work in progress before the service shuts down.
+// If ctx was not provided by a service, the default service is used.
+func Draining(ctx context.Context) <-chan struct{} {
+	if ch, ok := ctx.Value(drainingKey{}).(chan struct{}); ok {
+		return ch
+	}
+	return std.draining
+}
+
+// drainRoute puts the service into drain mode in response to a POST to
+// /lifecycle/drain.
+func (s *Service) drainRoute(w http.ResponseWriter, _ *http.Request) {
+	s.logInfo(noloc, "drain requested via API")
+	s.Drain()
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("DRAINING"))
+}
+
+// EventType identifies a transition in the lifecycle of a service.
+type EventType string
+
+const (
+	// EventDeclared is sent when the service has been declared with
+	// [Declare] or [New].
+	EventDeclared EventType = "declared"
+	// EventFlagsParsed is sent when the command-line flags have been parsed.
+	EventFlagsParsed EventType = "flags_parsed"
+	// EventServing is sent when the service begins serving, before any
+	// components or jobs have been started.
+	EventServing EventType = "serving"
+	// EventReady is sent once all components and jobs have been started.
+	EventReady EventType = "ready"
+	// EventDraining is sent when the service enters drain mode.
+	EventDraining EventType = "draining"
+	// EventShuttingDown is sent when the service begins to shut down. Its
+	// Reason says why, and its Err holds the error which caused it, if any.
+	EventShuttingDown EventType = "shutting_down"
+	// EventShutdownHandler is sent after each shutdown handler has run, with
+	// its error, if any.
+	EventShutdownHandler EventType = "shutdown_handler"
+	// EventExiting is sent just before the service exits, or before
+	// [Service.Run] returns, with the exit code.
+	EventExiting EventType = "exiting"
+)
+
+// Event is a transition in the lifecycle of a service. See [OnEvent].
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Reason describes the cause of the event, if there is one.
+	Reason string
+	// Err is the error associated with the event, if any.
+	Err error
+	// ExitCode is the code the service is exiting with, set for
+	// [EventExiting].
+	ExitCode int
+}
+
+// OnEvent adds a hook which is called with each lifecycle event of the
+// service, such as it starting to serve, entering drain mode or exiting. When
+// the hook is added, it is first called with any events which have already
+// happened, so hooks added after [Declare] still see [EventDeclared].
+//
+// Hooks are called synchronously and in order, so they should return quickly.
+// They must not call OnEvent or [Fatal]. The same event history is reported as
+// JSON at the /lifecycle route.
+func OnEvent(hook func(Event)) {
+	std.OnEvent(hook)
+}
+
+// OnEvent adds a lifecycle event hook to the service. See [OnEvent].
+func (s *Service) OnEvent(hook func(Event)) {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	for _, e := range s.events {
+		s.callHook(hook, e)
+	}
+	s.eventHooks = append(s.eventHooks, hook)
+}
+
+// emit records a lifecycle event and passes it to each hook.
+func (s *Service) emit(e Event) {
+	e.Time = time.Now()
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	s.events = append(s.events, e)
+	for _, hook := range s.eventHooks {
+		s.callHook(hook, e)
+	}
+}
+
+func (s *Service) callHook(hook func(Event), e Event) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.termLogErr(noloc, "event hook panicked", srverrors.Recovered(v), "event", e.Type)
+		}
+	}()
+	hook(e)
+}
+
+type eventJSON struct {
+	Type     EventType `json:"type"`
+	Time     time.Time `json:"time"`
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+}
+
+// lifecycleRoute reports the lifecycle event history of the service at the
+// /lifecycle route.
+func (s *Service) lifecycleRoute(w http.ResponseWriter, _ *http.Request) {
+	s.eventMu.Lock()
+	events := make([]eventJSON, 0, len(s.events))
+	for _, e := range s.events {
+		ej := eventJSON{
+			Type:   e.Type,
+			Time:   e.Time,
+			Reason: e.Reason,
+		}
+		if e.Err != nil {
+			ej.Error = e.Err.Error()
+		}
+		if e.Type == EventExiting {
+			code := e.ExitCode
+			ej.ExitCode = &code
+		}
+		events = append(events, ej)
+	}
+	s.eventMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Events []eventJSON `json:"events"`
+	}{events})
+}
@@ -0,0 +1,97 @@
+package srv
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"andy.dev/srv/internal/listenfd"
+	"andy.dev/srv/log"
+)
+
+// instrumentationListener is the name of the listener used by the
+// instrumentation server.
+const instrumentationListener = "instrumentation"
+
+// listeners passed to the process belong to it, rather than to any one
+// service, so they are only read once. Each may be claimed by a single call to
+// Listener.
+var (
+	muInherited     sync.Mutex
+	inheritedLoaded bool
+	inherited       []listenfd.Listener
+)
+
+type namedListener struct {
+	name string
+	ln   net.Listener
+}
+
+// Listener returns a listener for the given name. If a listener with this name
+// was passed to the process, either by systemd socket activation or by a
+// previous instance of the service handing over its sockets, it is returned.
+// Otherwise, a new listener is opened on addr, which may be a "host:port" or
+// "unix:/path/to/file.sock" address.
+//
+// Using Listener for every server in the service allows it to be restarted
+// without refusing connections. With systemd, the name is set with the
+// FileDescriptorName= option of the socket unit. The instrumentation server
+// uses the name "instrumentation".
+func Listener(name, addr string) (net.Listener, error) {
+	return std.listener(log.Up(1), name, addr)
+}
+
+// Listener returns a listener for the given name. See [Listener].
+func (s *Service) Listener(name, addr string) (net.Listener, error) {
+	return s.listener(log.Up(1), name, addr)
+}
+
+func (s *Service) listener(caller log.CodeLocation, name, addr string) (net.Listener, error) {
+	if name == "" || strings.ContainsAny(name, ":\n") {
+		return nil, fmt.Errorf("invalid listener name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.listeners {
+		if l.name == name {
+			return nil, fmt.Errorf("listener %q is already in use", name)
+		}
+	}
+	ln := s.claimInherited(name)
+	if ln != nil {
+		s.logInfo(caller, "using inherited listener", "listener", name, "addr", ln.Addr().String())
+	} else {
+		var err error
+		if ln, err = listen(addr); err != nil {
+			return nil, err
+		}
+		if ln == nil {
+			return nil, fmt.Errorf("no address for listener %q", name)
+		}
+	}
+	s.listeners = append(s.listeners, namedListener{name, ln})
+	return ln, nil
+}
+
+// claimInherited returns the first unclaimed listener passed to the process
+// with the given name, or nil if there is none.
+func (s *Service) claimInherited(name string) net.Listener {
+	muInherited.Lock()
+	defer muInherited.Unlock()
+	if !inheritedLoaded {
+		inheritedLoaded = true
+		var err error
+		inherited, err = listenfd.Listeners()
+		if err != nil {
+			s.logWarn(noloc, "ignoring invalid inherited listeners", err)
+		}
+	}
+	for i, l := range inherited {
+		if l.Name == name {
+			inherited = append(inherited[:i], inherited[i+1:]...)
+			return l.Listener
+		}
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log/slog"
 	"os"
-	"sync/atomic"
 
 	"andy.dev/srv/internal/loghandler"
 	"andy.dev/srv/internal/loghandler/instrumentation"
@@ -18,14 +17,12 @@ const (
 	noloc log.CodeLocation = 0
 )
 
-var (
-	srvlogger       atomic.Value
-	srvLogHandler   *instrumentation.Handler
-	srvLevelHandler *loglevelhandler.Handler
-)
-
 func srvLogger() *log.Logger {
-	return srvlogger.Load().(*log.Logger)
+	return std.rootLogger()
+}
+
+func (s *Service) rootLogger() *log.Logger {
+	return s.logger.Load().(*log.Logger)
 }
 
 // Logger is an alias to the [log.Logger] type, so that you don't need to import
@@ -54,17 +51,19 @@ const (
 	NoMetrics
 )
 
-func initLogging(config *srvConfig) {
-	var formatter slog.Handler
-	switch config.logFormat {
-	case "json":
-		formatter = loghandler.NewJSON(os.Stderr)
-	case "text":
-		formatter = loghandler.NewText(os.Stderr)
-	case "human":
-		formatter = loghandler.NewHuman(os.Stderr)
-	default:
-		formatter = loghandler.NewAuto(os.Stderr)
+func (s *Service) initLogging(config *srvConfig) {
+	formatter := s.logFormatter
+	if formatter == nil {
+		switch config.logFormat {
+		case "json":
+			formatter = loghandler.NewJSON(os.Stderr)
+		case "text":
+			formatter = loghandler.NewText(os.Stderr)
+		case "human":
+			formatter = loghandler.NewHuman(os.Stderr)
+		default:
+			formatter = loghandler.NewAuto(os.Stderr)
+		}
 	}
 	var rootLevel slog.Level
 	switch config.logLevel {
@@ -77,17 +76,17 @@ func initLogging(config *srvConfig) {
 	case "error":
 		rootLevel = slog.LevelError
 	}
-	srvLogHandler = instrumentation.NewHandler(formatter, instrumentation.HandlerOptions{
+	s.logHandler = instrumentation.NewHandler(formatter, instrumentation.HandlerOptions{
 		MinLevel:     rootLevel,
 		ShowLocation: true,
 		TrimCode:     true,
-		ErrorCounter: srvErrors.With("logger", "root"),
-		WarnCounter:  srvWarnings.With("logger", "root"),
-		InfoCounter:  srvInfos.With("logger", "root"),
+		ErrorCounter: s.metrics.errors.With("logger", "root"),
+		WarnCounter:  s.metrics.warnings.With("logger", "root"),
+		InfoCounter:  s.metrics.infos.With("logger", "root"),
 	})
 
-	srvLevelHandler = loglevelhandler.NewHandler(srvLogHandler)
-	srvlogger.Store(log.NewLogger(slog.New(srvLogHandler)))
+	s.levelHandler = loglevelhandler.NewHandler(s.logHandler)
+	s.logger.Store(log.NewLogger(slog.New(s.logHandler)))
 }
 
 // NewLogger creates a [*log.Logger] that will attach a "logger" label to its
@@ -96,12 +95,32 @@ func initLogging(config *srvConfig) {
 // allowing for dynamic level modification at runtime via the `/loglevel route`,
 // so multiple subloggers cannot have the same name.
 func NewLogger(name string, level LogLevel, flags int) *log.Logger {
+	return std.newLogger(log.Up(1), name, level, flags)
+}
+
+// NewLogger creates a logger tracked by the service. See [NewLogger].
+func (s *Service) NewLogger(name string, level LogLevel, flags int) *log.Logger {
+	return s.newLogger(log.Up(1), name, level, flags)
+}
+
+func (s *Service) newLogger(caller log.CodeLocation, name string, level LogLevel, flags int) *log.Logger {
+	logger, err := s.addLogger(caller, name, level, flags)
+	if err != nil {
+		s.logWarn(caller, "NewLogger(): logger level can't be changed at runtime", err)
+	}
+	return logger
+}
+
+// addLogger creates a logger tracked by the service. If one with the same name
+// is already tracked, an error is returned along with the logger, which works,
+// but isn't tracked.
+func (s *Service) addLogger(caller log.CodeLocation, name string, level LogLevel, flags int) (*log.Logger, error) {
 	// check if the user has set a minimum log level that is less than the
 	// minimum log level. If so, messages below this level won't
 	// appear, so issue a warning about that.
-	if !srvLogger().Enabled(level) {
-		rootLevel, _ := srvLogHandler.GetLevel()
-		sWarn(log.Up(2), "logger minimum level is less than current level", "logger", name, "current_level", rootLevel, "logger_level", level.String())
+	if !s.rootLogger().Enabled(level) {
+		rootLevel, _ := s.logHandler.GetLevel()
+		s.logWarn(caller, "logger minimum level is less than current level", "logger", name, "current_level", rootLevel, "logger_level", level.String())
 	}
 	levelVar := slog.LevelVar{}
 	levelVar.Set(level)
@@ -112,40 +131,42 @@ func NewLogger(name string, level LogLevel, flags int) *log.Logger {
 		TrimCode:     flags&LogFullLocation == 0,
 	}
 	if flags&NoMetrics == 0 {
-		handlerOpts.ErrorCounter = srvErrors.With("logger", name)
-		handlerOpts.WarnCounter = srvWarnings.With("logger", name)
-		handlerOpts.InfoCounter = srvInfos.With("logger", name)
+		handlerOpts.ErrorCounter = s.metrics.errors.With("logger", name)
+		handlerOpts.WarnCounter = s.metrics.warnings.With("logger", name)
+		handlerOpts.InfoCounter = s.metrics.infos.With("logger", name)
 	}
-	logHandler := instrumentation.NewHandler(srvLogHandler, handlerOpts)
-	srvLevelHandler.AddLogHandler(logHandler)
-	return log.NewLogger(slog.New(logHandler).With("logger", name))
+	logHandler := instrumentation.NewHandler(s.logHandler, handlerOpts)
+	err := s.levelHandler.AddLogHandler(logHandler)
+	return log.NewLogger(slog.New(logHandler).With("logger", name)), err
 }
 
 // internal
-func sDebug(loc log.CodeLocation, msg string, attrs ...any) {
-	srvLogger().Log(context.Background(), slog.LevelDebug, loc, msg, attrs...)
+func (s *Service) logDebug(loc log.CodeLocation, msg string, attrs ...any) {
+	s.rootLogger().Log(context.Background(), slog.LevelDebug, loc, msg, attrs...)
 }
 
-func sInfo(loc log.CodeLocation, msg string, attrs ...any) {
-	srvLogger().Log(context.Background(), slog.LevelInfo, loc, msg, attrs...)
+func (s *Service) logInfo(loc log.CodeLocation, msg string, attrs ...any) {
+	s.rootLogger().Log(context.Background(), slog.LevelInfo, loc, msg, attrs...)
 }
 
-func sWarn(loc log.CodeLocation, msg string, attrs ...any) {
-	srvLogger().Log(context.Background(), slog.LevelWarn, loc, msg, attrs...)
+func (s *Service) logWarn(loc log.CodeLocation, msg string, attrs ...any) {
+	s.rootLogger().Log(context.Background(), slog.LevelWarn, loc, msg, attrs...)
 }
 
-func sError(loc log.CodeLocation, msg string, attrs ...any) {
-	srvLogger().Log(context.Background(), slog.LevelError, loc, msg, attrs...)
+func (s *Service) logError(loc log.CodeLocation, msg string, attrs ...any) {
+	s.rootLogger().Log(context.Background(), slog.LevelError, loc, msg, attrs...)
 }
 
-func sTermLogErr(loc log.CodeLocation, msg string, attrs ...any) {
-	sError(loc, msg, attrs...)
+func (s *Service) termLogErr(loc log.CodeLocation, msg string, attrs ...any) {
+	s.logError(loc, msg, attrs...)
 	termlogWrite(loc, msg, attrs...)
 }
 
+// package-level helpers for the default service
+func sWarn(loc log.CodeLocation, msg string, attrs ...any) {
+	std.logWarn(loc, msg, attrs...)
+}
+
 func sFatal(loc log.CodeLocation, msg string, attrs ...any) {
-	srvLogger().Log(context.Background(), slog.LevelError, loc, "FATAL: "+msg, attrs...)
-	termlogWrite(loc, msg, attrs...)
-	termlogClose()
-	os.Exit(1)
+	std.fatal(loc, msg, attrs...)
 }
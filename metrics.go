@@ -11,7 +11,6 @@ import (
 	promkit "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
-	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 const (
@@ -19,20 +18,34 @@ const (
 	TimerMetricSuffix   = `_duration_seconds`
 )
 
-var (
-	srvRegistry *prometheus.Registry
-	srvErrors   metrics.Counter
-	srvWarnings metrics.Counter
-	srvInfos    metrics.Counter
-	srvPushURL  string
-	srvPusher   *push.Pusher
-)
+// srvMetrics are the metrics srv keeps about itself.
+type srvMetrics struct {
+	errors   metrics.Counter
+	warnings metrics.Counter
+	infos    metrics.Counter
+
+	jobRestarts   metrics.Counter
+	jobFailures   metrics.Counter
+	jobRunning    metrics.Gauge
+	jobExitStatus metrics.Gauge
+	authFailures  metrics.Counter
 
-func initMetrics() {
-	srvRegistry = prometheus.NewRegistry()
+	scheduledLastRun  metrics.Gauge
+	scheduledDuration metrics.Histogram
+	scheduledFailures metrics.Counter
+
+	healthStatus   metrics.Gauge
+	healthFailures metrics.Gauge
+	healthDuration metrics.Histogram
+	healthFailed   metrics.Counter
+}
+
+func (s *Service) initMetrics() {
+	registry := prometheus.NewRegistry()
+	m := &srvMetrics{}
 	// by creating a new registry, we avoid the old memstats-style Go runtime
 	// metrics, and can register the newer runtime/metrics driven stats instead.
-	srvRegistry.MustRegister(collectors.NewGoCollector(
+	registry.MustRegister(collectors.NewGoCollector(
 		collectors.WithGoCollectorMemStatsMetricsDisabled(),
 		collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsAll),
 	))
@@ -40,26 +53,113 @@ func initMetrics() {
 		Name: "error_messages",
 		Help: "the total number of error messages logged",
 	}, []string{"logger"})
-	srvRegistry.MustRegister(errVec)
+	registry.MustRegister(errVec)
 	wrnVec := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "warning_messages",
 		Help: "the total number of warning messages logged",
 	}, []string{"logger"})
-	srvRegistry.MustRegister(wrnVec)
+	registry.MustRegister(wrnVec)
 	infVec := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "info_messages",
 		Help: "the total number of info messages logged",
 	}, []string{"logger"})
-	srvRegistry.MustRegister(infVec)
-	srvErrors = promkit.NewCounter(errVec)
-	srvWarnings = promkit.NewCounter(wrnVec)
-	srvInfos = promkit.NewCounter(infVec)
+	registry.MustRegister(infVec)
+	m.errors = promkit.NewCounter(errVec)
+	m.warnings = promkit.NewCounter(wrnVec)
+	m.infos = promkit.NewCounter(infVec)
+
+	restartVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "job_restarts_total",
+		Help: "the total number of times a supervised job has been restarted",
+	}, []string{"job"})
+	registry.MustRegister(restartVec)
+	failureVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "job_failures_total",
+		Help: "the total number of times a supervised job has failed",
+	}, []string{"job"})
+	registry.MustRegister(failureVec)
+	m.jobRestarts = promkit.NewCounter(restartVec)
+	m.jobFailures = promkit.NewCounter(failureVec)
+
+	runningVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "job_running",
+		Help: "whether a job is currently running (1) or not (0)",
+	}, []string{"job"})
+	registry.MustRegister(runningVec)
+	exitVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "job_exit_status",
+		Help: "the exit status of a job that has returned: success (0) or failure (1)",
+	}, []string{"job"})
+	registry.MustRegister(exitVec)
+	m.jobRunning = promkit.NewGauge(runningVec)
+	m.jobExitStatus = promkit.NewGauge(exitVec)
+
+	authVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "instrumentation_auth_failures_total",
+		Help: "the total number of instrumentation requests denied for missing or invalid credentials",
+	}, []string{"reason"})
+	registry.MustRegister(authVec)
+	m.authFailures = promkit.NewCounter(authVec)
+
+	lastRunVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduled_job_last_run_timestamp_seconds",
+		Help: "the unix time at which a scheduled job last started a run",
+	}, []string{"job"})
+	registry.MustRegister(lastRunVec)
+	durationVec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduled_job_duration_seconds",
+		Help:    "the time taken by each run of a scheduled job",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"job"})
+	registry.MustRegister(durationVec)
+	schedFailureVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduled_job_failures_total",
+		Help: "the total number of failed runs of a scheduled job",
+	}, []string{"job"})
+	registry.MustRegister(schedFailureVec)
+	m.scheduledLastRun = promkit.NewGauge(lastRunVec)
+	m.scheduledDuration = promkit.NewHistogram(durationVec)
+	m.scheduledFailures = promkit.NewCounter(schedFailureVec)
+
+	healthStatusVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_status",
+		Help: "whether a health or readiness check is passing (1) or has failed (0)",
+	}, []string{"type", "check"})
+	registry.MustRegister(healthStatusVec)
+	healthFailuresVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_consecutive_failures",
+		Help: "the number of times in a row a health or readiness check has failed",
+	}, []string{"type", "check"})
+	registry.MustRegister(healthFailuresVec)
+	healthDurationVec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "healthcheck_duration_seconds",
+		Help:    "the time taken by each run of a health or readiness check",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"type", "check"})
+	registry.MustRegister(healthDurationVec)
+	healthFailedVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "healthcheck_failures_total",
+		Help: "the total number of failed runs of a health or readiness check",
+	}, []string{"type", "check"})
+	registry.MustRegister(healthFailedVec)
+	m.healthStatus = promkit.NewGauge(healthStatusVec)
+	m.healthFailures = promkit.NewGauge(healthFailuresVec)
+	m.healthDuration = promkit.NewHistogram(healthDurationVec)
+	m.healthFailed = promkit.NewCounter(healthFailedVec)
+
+	s.registry = registry
+	s.metrics = m
 }
 
 // Registry returns the service prometheus registry for plugins/packages that
 // can use it.
 func Registry() prometheus.Registerer {
-	return srvRegistry
+	return std.registry
+}
+
+// Registry returns the prometheus registry of the service. See [Registry].
+func (s *Service) Registry() prometheus.Registerer {
+	return s.registry
 }
 
 // TODO add guard to all new funcs to fail gracefully instead of panicing.
@@ -76,7 +176,7 @@ func NewCounter(name, help string, labelNames ...string) metrics.Counter {
 		Name: name,
 		Help: help,
 	}, labelNames)
-	srvRegistry.MustRegister(counter)
+	std.registry.MustRegister(counter)
 	return promkit.NewCounter(counter)
 }
 
@@ -89,7 +189,7 @@ func NewGauge(name, help string, labelNames ...string) metrics.Gauge {
 		Name: name,
 		Help: help,
 	}, labelNames)
-	srvRegistry.MustRegister(gauge)
+	std.registry.MustRegister(gauge)
 	return promkit.NewGauge(gauge)
 }
 
@@ -101,7 +201,7 @@ func NewSummary(name, help string, labelNames ...string) metrics.Histogram {
 		Name: name,
 		Help: help,
 	}, labelNames)
-	srvRegistry.MustRegister(summary)
+	std.registry.MustRegister(summary)
 	return promkit.NewSummary(summary)
 }
 
@@ -114,7 +214,7 @@ func NewHistogram(name, help string, buckets []float64, labelNames ...string) me
 		Help:    help,
 		Buckets: buckets,
 	}, labelNames)
-	srvRegistry.MustRegister(histogram)
+	std.registry.MustRegister(histogram)
 	return promkit.NewHistogram(histogram)
 }
 
@@ -162,7 +262,7 @@ func NewTimer(name, help string, buckets []time.Duration, labelNames ...string)
 		Help:    help,
 		Buckets: floatBuckets,
 	}, labelNames)
-	srvRegistry.MustRegister(h)
+	std.registry.MustRegister(h)
 	return &Timer{hv: h}
 }
 
@@ -0,0 +1,238 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"andy.dev/srv/errors"
+	"andy.dev/srv/internal/cron"
+	"andy.dev/srv/log"
+)
+
+// OverlapPolicy determines what happens when a scheduled job comes due while
+// its previous run is still in progress.
+type OverlapPolicy int
+
+const (
+	// SkipOverlap skips the run. This is the default.
+	SkipOverlap OverlapPolicy = iota
+	// QueueOverlap starts the run as soon as the previous one finishes. At
+	// most one run is queued; any which come due while one is already
+	// waiting are skipped.
+	QueueOverlap
+)
+
+// ScheduleOption configures a scheduled job. See [AddPeriodicJob] and
+// [AddCronJob].
+type ScheduleOption func(sp *schedulePolicy) error
+
+type schedulePolicy struct {
+	overlap  OverlapPolicy
+	jitter   time.Duration
+	location *time.Location
+}
+
+// Overlap sets what happens when a scheduled job comes due while its previous
+// run is still in progress. Default: [SkipOverlap]
+func Overlap(policy OverlapPolicy) ScheduleOption {
+	return func(sp *schedulePolicy) error {
+		switch policy {
+		case SkipOverlap, QueueOverlap:
+		default:
+			return fmt.Errorf("unknown overlap policy: %d", policy)
+		}
+		sp.overlap = policy
+		return nil
+	}
+}
+
+// RandomDelay delays each run of a scheduled job by a random duration of up to
+// max, so that many instances of a service don't all run their jobs at the
+// same moment. Default: 0
+func RandomDelay(max time.Duration) ScheduleOption {
+	return func(sp *schedulePolicy) error {
+		if max < 0 {
+			return fmt.Errorf("random delay cannot be negative")
+		}
+		sp.jitter = max
+		return nil
+	}
+}
+
+// TimeZone sets the location in which a cron schedule is evaluated. It has no
+// effect on periodic jobs. Default: UTC
+func TimeZone(loc *time.Location) ScheduleOption {
+	return func(sp *schedulePolicy) error {
+		if loc == nil {
+			return fmt.Errorf("time zone cannot be nil")
+		}
+		sp.location = loc
+		return nil
+	}
+}
+
+// AddPeriodicJob adds a named job which is run every interval, starting one
+// interval after [Serve] is called. Unlike other jobs, a scheduled job which
+// returns an error does not shut down the service. Instead, the failure is
+// logged and counted, and the job will be run again at its next scheduled
+// time.
+//
+// Scheduled jobs report the time of their last run, the duration of each run
+// and their failures in the scheduled_job_last_run_timestamp_seconds,
+// scheduled_job_duration_seconds and scheduled_job_failures_total metrics.
+func AddPeriodicJob(name string, interval time.Duration, job JobFn, options ...ScheduleOption) {
+	std.addPeriodicJob(log.Up(1), name, interval, job, options)
+}
+
+// AddPeriodicJob adds a periodic job to the service. See [AddPeriodicJob].
+func (s *Service) AddPeriodicJob(name string, interval time.Duration, job JobFn, options ...ScheduleOption) {
+	s.addPeriodicJob(log.Up(1), name, interval, job, options)
+}
+
+func (s *Service) addPeriodicJob(caller log.CodeLocation, name string, interval time.Duration, job JobFn, options []ScheduleOption) {
+	if interval <= 0 {
+		s.fatal(caller, "AddPeriodicJob(): interval must be greater than 0")
+		return
+	}
+	policy, err := newSchedulePolicy(options)
+	if err != nil {
+		s.fatal(caller, "bad schedule option", err)
+		return
+	}
+	next := func(t time.Time) time.Time {
+		return t.Add(interval)
+	}
+	s.addNamedJob(caller, name, s.scheduled(name, next, policy, job))
+}
+
+// AddCronJob adds a named job which is run on a cron schedule, such as
+// "0 2 * * *" for 02:00 every day. The schedule is made up of five fields:
+// minute, hour, day of month, month and day of week. Each may be a "*", a
+// value, a range ("1-5"), a list ("1,3,5"), or any of these with a step
+// ("*/15"). Months and days of the week may also be given by name ("jan",
+// "mon"), and the macros @hourly, @daily, @weekly, @monthly and @yearly are
+// also accepted. Schedules are evaluated in UTC unless set with [TimeZone].
+//
+// Cron jobs behave like those added with [AddPeriodicJob].
+func AddCronJob(name, schedule string, job JobFn, options ...ScheduleOption) {
+	std.addCronJob(log.Up(1), name, schedule, job, options)
+}
+
+// AddCronJob adds a cron job to the service. See [AddCronJob].
+func (s *Service) AddCronJob(name, schedule string, job JobFn, options ...ScheduleOption) {
+	s.addCronJob(log.Up(1), name, schedule, job, options)
+}
+
+func (s *Service) addCronJob(caller log.CodeLocation, name, schedule string, job JobFn, options []ScheduleOption) {
+	policy, err := newSchedulePolicy(options)
+	if err != nil {
+		s.fatal(caller, "bad schedule option", err)
+		return
+	}
+	sched, err := cron.Parse(schedule, policy.location)
+	if err != nil {
+		s.fatal(caller, "AddCronJob(): invalid schedule", err, "schedule", schedule)
+		return
+	}
+	if sched.Next(time.Now()).IsZero() {
+		s.fatal(caller, "AddCronJob(): schedule never runs", "schedule", schedule)
+		return
+	}
+	s.addNamedJob(caller, name, s.scheduled(name, sched.Next, policy, job))
+}
+
+func newSchedulePolicy(options []ScheduleOption) (*schedulePolicy, error) {
+	policy := &schedulePolicy{
+		overlap:  SkipOverlap,
+		location: time.UTC,
+	}
+	for _, o := range options {
+		if err := o(policy); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// scheduled returns a job which runs job at each time returned by next, until
+// the service shuts down.
+func (s *Service) scheduled(name string, next func(time.Time) time.Time, policy *schedulePolicy, job JobFn) JobFn {
+	return func(ctx context.Context, logger *Logger) error {
+		// an unbuffered channel can only be sent on while the runner is idle,
+		// so a non-blocking send skips runs which overlap. A buffer of one
+		// allows a single run to be queued instead.
+		var due chan struct{}
+		if policy.overlap == QueueOverlap {
+			due = make(chan struct{}, 1)
+		} else {
+			due = make(chan struct{})
+		}
+		runnerDone := make(chan struct{})
+		go func() {
+			defer close(runnerDone)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-due:
+					s.runScheduled(ctx, name, job, logger)
+				}
+			}
+		}()
+		// don't return while a run is still in progress.
+		defer func() { <-runnerDone }()
+
+		scheduled := time.Now()
+		for {
+			scheduled = next(scheduled)
+			if now := time.Now(); !scheduled.IsZero() && scheduled.Before(now) {
+				// fell behind, perhaps due to a suspended host. Don't try to
+				// catch up on every missed run.
+				scheduled = next(now)
+			}
+			if scheduled.IsZero() {
+				logger.Warn("job schedule has no more runs", "job", name)
+				<-ctx.Done()
+				return nil
+			}
+			fire := scheduled
+			if policy.jitter > 0 {
+				fire = fire.Add(time.Duration(rand.Int63n(int64(policy.jitter))))
+			}
+			timer := time.NewTimer(time.Until(fire))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+			select {
+			case due <- struct{}{}:
+			default:
+				logger.Warn("skipping scheduled run, previous run still in progress", "job", name, "scheduled", scheduled)
+			}
+		}
+	}
+}
+
+// runScheduled runs a single scheduled run of a job, recording its metrics.
+func (s *Service) runScheduled(ctx context.Context, name string, job JobFn, logger *Logger) {
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = errors.Recovered(v)
+				termlogWrite(noloc, "scheduled run panicked", err, "job", name)
+			}
+		}()
+		return job(ctx, logger)
+	}()
+	s.metrics.scheduledLastRun.With("job", name).Set(float64(start.Unix()))
+	s.metrics.scheduledDuration.With("job", name).Observe(time.Since(start).Seconds())
+	if err != nil && ctx.Err() == nil {
+		s.metrics.scheduledFailures.With("job", name).Add(1)
+		logger.Error("scheduled run failed", err, "job", name)
+	}
+}
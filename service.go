@@ -0,0 +1,263 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"andy.dev/srv/buildinfo"
+	"andy.dev/srv/internal/health"
+	"andy.dev/srv/internal/loghandler/inithandler"
+	"andy.dev/srv/internal/loghandler/instrumentation"
+	"andy.dev/srv/internal/loglevelhandler"
+	"andy.dev/srv/internal/sdnotify"
+	"andy.dev/srv/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// std is the default service, used by all of the package-level functions.
+var std *Service
+
+var errAlreadyRun = errors.New("service has already been run")
+
+// Service is a single service instance, with its own jobs, health checks,
+// loggers, metrics registry and instrumentation server. Most programs will use
+// the package-level functions, which act on a default Service. A Service
+// created with [New] can be used to test a service, or to run more than one in
+// the same process.
+type Service struct {
+	mu           sync.Mutex
+	serviceInfo  *ServiceInfo
+	served       bool
+	exitOnFatal  bool
+	errMu        sync.Mutex
+	setupErr     error
+	args         []string
+	logFormatter slog.Handler
+	config       *srvConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger       atomic.Value
+	logHandler   *instrumentation.Handler
+	levelHandler *loglevelhandler.Handler
+
+	registry *prometheus.Registry
+	metrics  *srvMetrics
+	pusher   *push.Pusher
+
+	health    *health.Handler
+	readiness *health.ReadinessHandler
+	startup   *health.StartupHandler
+	notifier  *sdnotify.Notifier
+
+	http              *http.Server
+	listeners         []namedListener
+	jobs              []*jobEntry
+	jobsStarted       bool
+	stopping          bool
+	runningJobs       int
+	jobsRunning       sync.WaitGroup
+	jobResults        chan jobResult
+	components        []*component
+	startedComponents []*component
+	shutdownHandlers  []shutdownHandler
+
+	shutdownSignals []os.Signal
+	forceSignals    []os.Signal
+	ignoreSignals   []os.Signal
+	drainSignals    []os.Signal
+	upgradeSignals  []os.Signal
+
+	drainOnce sync.Once
+	draining  chan struct{}
+
+	upgrading  atomic.Bool
+	handedOver atomic.Bool
+
+	eventMu    sync.Mutex
+	events     []Event
+	eventHooks []func(Event)
+}
+
+// Option configures a [Service] created with [New].
+type Option func(s *Service) error
+
+// WithArgs sets the command-line arguments from which the service reads its
+// configuration flags, such as --log-level and --instrumentation-addr. By
+// default, a Service created with [New] uses the flag defaults, along with any
+// SRV_ environment variables.
+func WithArgs(args ...string) Option {
+	return func(s *Service) error {
+		s.args = args
+		return nil
+	}
+}
+
+// WithLogHandler sets the handler used to format the service's log output,
+// overriding --log-format.
+func WithLogHandler(handler slog.Handler) Option {
+	return func(s *Service) error {
+		if handler == nil {
+			return fmt.Errorf("log handler cannot be nil")
+		}
+		s.logFormatter = handler
+		return nil
+	}
+}
+
+// New creates a service. Its methods mirror the package-level functions, but
+// errors in configuring it will not exit the program. Instead, the first such
+// error is logged and returned by [Service.Run].
+func New(serviceInfo ServiceInfo, options ...Option) *Service {
+	caller := log.Up(1)
+	s := newService(false)
+	for _, o := range options {
+		if err := o(s); err != nil {
+			s.fatal(caller, "bad service option", err)
+		}
+	}
+	config, err := parseConfig(s.args)
+	s.init(config, err)
+	if err == nil {
+		s.emit(Event{Type: EventFlagsParsed})
+	}
+	s.mu.Lock()
+	declared := s.declare(caller, serviceInfo)
+	s.mu.Unlock()
+	if declared {
+		s.emit(Event{Type: EventDeclared})
+	}
+	return s
+}
+
+func newService(exitOnFatal bool) *Service {
+	s := &Service{
+		exitOnFatal:     exitOnFatal,
+		shutdownSignals: []os.Signal{os.Interrupt, syscall.SIGTERM},
+		draining:        make(chan struct{}),
+		jobResults:      make(chan jobResult),
+	}
+	if exitOnFatal {
+		// only the default service owns the process, so only it can replace
+		// it.
+		s.upgradeSignals = []os.Signal{syscall.SIGUSR2}
+	}
+	s.ctx, s.cancel = context.WithCancel(context.WithValue(context.Background(), drainingKey{}, s.draining))
+	// set up a basic logger for before we can set the user's logging handler.
+	s.logger.Store(log.NewLogger(slog.New(inithandler.New())))
+	return s
+}
+
+func (s *Service) init(config *srvConfig, err error) {
+	if err != nil {
+		s.fatal(noloc, err.Error())
+	}
+	s.config = config
+	s.initMetrics()
+	s.initLogging(config)
+	s.initHealth()
+}
+
+// declare sets the service info, returning whether it was set.
+// must be called with s.mu held.
+func (s *Service) declare(caller log.CodeLocation, serviceInfo ServiceInfo) bool {
+	if s.serviceInfo != nil {
+		s.logWarn(caller, "Declare(): ignoring duplicate call")
+		return false
+	}
+	if buildinfo.Version != "" {
+		if serviceInfo.Version != "" {
+			s.fatal(caller, "version specified in build tags, but manual version provided")
+			return false
+		}
+		serviceInfo.Version = buildinfo.Version
+	}
+	if err := validateInfo(serviceInfo); err != nil {
+		s.fatal(caller, "Declare():", err)
+		return false
+	}
+	s.serviceInfo = &serviceInfo
+	s.logger.Store(s.rootLogger().With("service", serviceInfo))
+	return true
+}
+
+// Run serves all endpoints and runs all jobs like [Serve], blocking until the
+// service has shut down. Rather than exiting the program, it returns nil if
+// the service shut down cleanly, or an [*ExitError] holding the status it
+// would have exited with. Cancelling ctx shuts the service down gracefully.
+//
+// A Service can only be run once.
+func (s *Service) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.served {
+		s.mu.Unlock()
+		return errAlreadyRun
+	}
+	s.served = true
+	s.mu.Unlock()
+	if err := s.err(); err != nil {
+		s.emit(Event{Type: EventExiting, Reason: "invalid configuration", Err: err, ExitCode: ExitConfig})
+		return &ExitError{Code: ExitConfig, Err: err}
+	}
+	stop := context.AfterFunc(ctx, s.cancel)
+	defer stop()
+	return s.serve()
+}
+
+// Serve runs the service like [Service.Run], exiting the program with its exit
+// status once it has shut down.
+func (s *Service) Serve() {
+	caller := log.Up(1)
+	err := s.Run(context.Background())
+	if errors.Is(err, errAlreadyRun) {
+		s.logWarn(caller, "Serve(): ignoring duplicate call")
+		return
+	}
+	termlogClose()
+	os.Exit(exitStatus(err))
+}
+
+// err returns the first fatal error encountered while configuring the service.
+func (s *Service) err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.setupErr
+}
+
+// fatal logs an unrecoverable error in configuring the service. The default
+// service exits immediately with [ExitConfig], while services created with
+// [New] record the first such error to be returned by [Service.Run], so callers
+// must return after calling it.
+func (s *Service) fatal(loc log.CodeLocation, msg string, attrs ...any) {
+	s.fatalCode(loc, ExitConfig, msg, attrs...)
+}
+
+func (s *Service) fatalCode(loc log.CodeLocation, code int, msg string, attrs ...any) {
+	s.rootLogger().Log(context.Background(), slog.LevelError, loc, "FATAL: "+msg, attrs...)
+	termlogWrite(loc, msg, attrs...)
+	if s.exitOnFatal {
+		s.emit(Event{Type: EventExiting, Reason: msg, ExitCode: code})
+		termlogClose()
+		os.Exit(code)
+	}
+	err := errors.New(msg)
+	if len(attrs) > 0 {
+		if attrErr, ok := attrs[0].(error); ok {
+			err = fmt.Errorf("%s %w", msg, attrErr)
+		}
+	}
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if s.setupErr == nil {
+		s.setupErr = err
+	}
+}
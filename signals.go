@@ -0,0 +1,123 @@
+package srv
+
+import (
+	"os"
+	"os/signal"
+	"slices"
+
+	"andy.dev/srv/log"
+)
+
+// ShutdownSignals sets the signals which will trigger a graceful shutdown of
+// the service. If any of these signals is received a second time while the
+// service is shutting down, it will exit immediately.
+// Default: SIGINT, SIGTERM
+func ShutdownSignals(signals ...os.Signal) {
+	std.setSignals(log.Up(1), &std.shutdownSignals, signals)
+}
+
+// ShutdownSignals sets the signals which trigger a graceful shutdown of the
+// service. See [ShutdownSignals].
+func (s *Service) ShutdownSignals(signals ...os.Signal) {
+	s.setSignals(log.Up(1), &s.shutdownSignals, signals)
+}
+
+// ForceExitSignals sets the signals which will cause the service to exit
+// immediately, without running shutdown handlers.
+// Default: none
+func ForceExitSignals(signals ...os.Signal) {
+	std.setSignals(log.Up(1), &std.forceSignals, signals)
+}
+
+// ForceExitSignals sets the signals which cause the service to exit
+// immediately. See [ForceExitSignals].
+func (s *Service) ForceExitSignals(signals ...os.Signal) {
+	s.setSignals(log.Up(1), &s.forceSignals, signals)
+}
+
+// IgnoreSignals sets the signals which will be ignored by the service.
+// Default: none
+func IgnoreSignals(signals ...os.Signal) {
+	std.setSignals(log.Up(1), &std.ignoreSignals, signals)
+}
+
+// IgnoreSignals sets the signals which are ignored by the service. See
+// [IgnoreSignals].
+func (s *Service) IgnoreSignals(signals ...os.Signal) {
+	s.setSignals(log.Up(1), &s.ignoreSignals, signals)
+}
+
+// DrainSignals sets the signals which will put the service into drain mode.
+// See [Drain].
+// Default: none
+func DrainSignals(signals ...os.Signal) {
+	std.setSignals(log.Up(1), &std.drainSignals, signals)
+}
+
+// DrainSignals sets the signals which put the service into drain mode. See
+// [DrainSignals].
+func (s *Service) DrainSignals(signals ...os.Signal) {
+	s.setSignals(log.Up(1), &s.drainSignals, signals)
+}
+
+// setSignals replaces a signal set, removing the signals from any of the other
+// sets, so that the most recent call for a given signal wins.
+func (s *Service) setSignals(caller log.CodeLocation, set *[]os.Signal, signals []os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.served {
+		s.fatal(caller, "signal handling can't be changed after Serve()")
+		return
+	}
+	for _, sigs := range []*[]os.Signal{&s.shutdownSignals, &s.forceSignals, &s.ignoreSignals, &s.drainSignals, &s.upgradeSignals} {
+		*sigs = slices.DeleteFunc(*sigs, func(sig os.Signal) bool {
+			return slices.Contains(signals, sig)
+		})
+	}
+	*set = slices.Clone(signals)
+}
+
+// notifySignals begins relaying all shutdown, drain, upgrade and force-exit
+// signals to the returned channel, and ignores any signals configured to be
+// ignored. The returned function stops relaying signals.
+func (s *Service) notifySignals() (<-chan os.Signal, func()) {
+	// Rather than using signal.NotifyContext, which would merely cancel a
+	// context, we use the manual method so that we can handle it twice if
+	// necessary (i.e. if the user is hands-on-keyboard testing and doesn't want
+	// to wait for the shutdown to complete). Because signal delivery is
+	// NON-blocking, we need enough buffer to account for both of these signals,
+	// hence the channel depth of 2.
+	signals := make(chan os.Signal, 2)
+	if len(s.ignoreSignals) > 0 {
+		signal.Ignore(s.ignoreSignals...)
+	}
+	watched := append(slices.Clone(s.shutdownSignals), s.forceSignals...)
+	watched = append(watched, s.drainSignals...)
+	watched = append(watched, s.upgradeSignals...)
+	if len(watched) > 0 {
+		signal.Notify(signals, watched...)
+	}
+	return signals, func() { signal.Stop(signals) }
+}
+
+func (s *Service) isForceSignal(sig os.Signal) bool {
+	return slices.Contains(s.forceSignals, sig)
+}
+
+func (s *Service) isDrainSignal(sig os.Signal) bool {
+	return slices.Contains(s.drainSignals, sig)
+}
+
+func (s *Service) isUpgradeSignal(sig os.Signal) bool {
+	return slices.Contains(s.upgradeSignals, sig)
+}
+
+// forceExit exits the program immediately. Since signals are delivered to the
+// whole process, this is true even for services run with [Service.Run].
+func (s *Service) forceExit(sig os.Signal) {
+	s.logInfo(noloc, "forced shutdown", "signal", sig.String())
+	termlogWrite(noloc, "SHUTDOWN - FORCED", "signal", sig.String())
+	s.emit(Event{Type: EventExiting, Reason: "forced by signal " + sig.String(), ExitCode: ExitForced})
+	termlogClose()
+	os.Exit(ExitForced)
+}
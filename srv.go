@@ -4,62 +4,37 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log/slog"
 	"os"
-	"sync"
+	"time"
 
-	"andy.dev/srv/buildinfo"
 	"andy.dev/srv/internal/health"
-	"andy.dev/srv/internal/loghandler/inithandler"
 	"andy.dev/srv/log"
 )
 
-var (
-	srvMu      sync.Mutex
-	didDeclare bool
-	didServe   bool
-)
-
-var (
-	srvInfo   *ServiceInfo
-	srvCtx    context.Context
-	srvCancel context.CancelFunc
-)
-
 func Declare(serviceInfo ServiceInfo) {
 	caller := log.Up(1)
-	srvMu.Lock()
-	defer srvMu.Unlock()
-	if didDeclare {
-		sWarn(caller, "Declare(): ignoring duplicate call")
-	}
-	if buildinfo.Version != "" {
-		if serviceInfo.Version != "" {
-			sFatal(caller, "version specified in build tags, but manual version provided")
-		}
-		serviceInfo.Version = buildinfo.Version
-	}
-	if err := validateInfo(serviceInfo); err != nil {
-		sFatal(caller, "Declare():", err)
+	std.mu.Lock()
+	declared := std.declare(caller, serviceInfo)
+	std.mu.Unlock()
+	if declared {
+		std.emit(Event{Type: EventDeclared})
 	}
-	srvInfo = &serviceInfo
-	srvlogger.Store(srvLogger().With("service", serviceInfo))
-	didDeclare = true
 }
 
 // Serve serves all endpoints and begins running all tasks. It will block until
-// all tasks have completed or until the service is shut down.
+// all tasks have completed or until the service is shut down, then exit the
+// program.
 func Serve() {
 	caller := log.Up(1)
-	srvMu.Lock()
-	defer srvMu.Unlock()
-	if didServe {
+	std.mu.Lock()
+	if std.served {
+		std.mu.Unlock()
 		// already have the package instance. Use it to log a warning
 		sWarn(caller, "Serve(): ignoring duplicate call")
 		return
 	}
 
-	if !didDeclare {
+	if std.serviceInfo == nil {
 		sFatal(caller, "Declare() not called before Serve()")
 	}
 
@@ -76,8 +51,11 @@ func Serve() {
 	case err != nil:
 		sFatal(caller, "Serve()", err)
 	}
-	serve(*srvInfo)
-	didServe = true
+	std.mu.Unlock()
+	if err == nil {
+		std.emit(Event{Type: EventFlagsParsed})
+	}
+	std.Serve()
 }
 
 // AddHealthCheck adds an asynchronous self-reporting health check job whose
@@ -86,28 +64,120 @@ func Serve() {
 // Checks may have an optional maximum number of failures, allowing them to
 // remain healthy until they fail N number of times in a row.
 func AddHealthCheck(ID string, checkFn JobFn, options ...HealthCheckOption) {
-	caller := log.Up(1)
+	std.addHealthCheck(log.Up(1), ID, checkFn, options)
+}
+
+// AddHealthCheck adds a health check to the service. See [AddHealthCheck].
+func (s *Service) AddHealthCheck(ID string, checkFn JobFn, options ...HealthCheckOption) {
+	s.addHealthCheck(log.Up(1), ID, checkFn, options)
+}
+
+func (s *Service) addHealthCheck(caller log.CodeLocation, ID string, checkFn JobFn, options []HealthCheckOption) {
+	hc := &health.HealthCheck{
+		ID: ID,
+		Fn: checkFn,
+	}
+	for _, o := range options {
+		if err := o(hc); err != nil {
+			s.fatal(caller, "bad health check option", err)
+			return
+		}
+	}
+	if err := s.health.AddCheck(hc); err != nil {
+		s.fatal(caller, "failed to add health check", err)
+	}
+}
+
+// AddReadinessCheck adds an asynchronous self-reporting readiness check job
+// whose status will be reported at the /readyz route. Readiness checks take the
+// same options as health checks and are scheduled the same way, however a
+// failed readiness check does not mark the service as unhealthy. Instead, it
+// will continue to be run, and the service will be reported as ready again
+// once it succeeds.
+func AddReadinessCheck(ID string, checkFn JobFn, options ...HealthCheckOption) {
+	std.addReadinessCheck(log.Up(1), ID, checkFn, options)
+}
+
+// AddReadinessCheck adds a readiness check to the service. See
+// [AddReadinessCheck].
+func (s *Service) AddReadinessCheck(ID string, checkFn JobFn, options ...HealthCheckOption) {
+	s.addReadinessCheck(log.Up(1), ID, checkFn, options)
+}
+
+func (s *Service) addReadinessCheck(caller log.CodeLocation, ID string, checkFn JobFn, options []HealthCheckOption) {
 	hc := &health.HealthCheck{
 		ID: ID,
 		Fn: checkFn,
 	}
 	for _, o := range options {
 		if err := o(hc); err != nil {
-			sFatal(caller, "bad health check option", err)
+			s.fatal(caller, "bad readiness check option", err)
+			return
 		}
 	}
-	if err := srvHealth.AddCheck(hc); err != nil {
-		sFatal(caller, "failed to add health check", err)
+	if err := s.readiness.AddCheck(hc); err != nil {
+		s.fatal(caller, "failed to add readiness check", err)
 	}
 }
 
+// SetReady sets whether the service is ready to receive traffic, as reported at
+// the /readyz route, independently of any readiness checks. The service is
+// ready by default. Jobs which need time to warm up can call SetReady(false)
+// before [Serve], and SetReady(true) once they are prepared.
+func SetReady(ready bool) {
+	std.SetReady(ready)
+}
+
+// SetReady sets whether the service is ready to receive traffic. See
+// [SetReady].
+func (s *Service) SetReady(ready bool) {
+	s.readiness.SetReady(ready)
+}
+
 // AddShutdownHandler adds a job that will be run when the service is shut down.
 // Shutdown handlers will be run synchronously, in the order they are defined.
 // If a shutdown handler panics, the rest of the handlers will be skipped.
+//
+// The context passed to shutdown handlers will be cancelled when the overall
+// shutdown deadline set with --shutdown-timeout expires.
 func AddShutdownHandler(handlers ...JobFn) {
-	srvMu.Lock()
-	defer srvMu.Unlock()
-	srvShutdownHandlers = append(srvShutdownHandlers, handlers...)
+	std.AddShutdownHandler(handlers...)
+}
+
+// AddShutdownHandler adds shutdown handlers to the service. See
+// [AddShutdownHandler].
+func (s *Service) AddShutdownHandler(handlers ...JobFn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range handlers {
+		s.shutdownHandlers = append(s.shutdownHandlers, shutdownHandler{fn: h})
+	}
+}
+
+// AddShutdownHandlerTimeout adds shutdown handlers like [AddShutdownHandler],
+// but each handler is limited to running for the given timeout. If a handler
+// takes longer than this, its context will be cancelled and it will be
+// considered to have failed, even if it does not return.
+func AddShutdownHandlerTimeout(timeout time.Duration, handlers ...JobFn) {
+	std.addShutdownHandlerTimeout(log.Up(1), timeout, handlers)
+}
+
+// AddShutdownHandlerTimeout adds shutdown handlers with a timeout to the
+// service. See [AddShutdownHandlerTimeout].
+func (s *Service) AddShutdownHandlerTimeout(timeout time.Duration, handlers ...JobFn) {
+	s.addShutdownHandlerTimeout(log.Up(1), timeout, handlers)
+}
+
+func (s *Service) addShutdownHandlerTimeout(caller log.CodeLocation, timeout time.Duration, handlers []JobFn) {
+	if timeout <= 0 {
+		s.fatal(caller, "AddShutdownHandlerTimeout(): timeout must be greater than 0")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range handlers {
+		s.shutdownHandlers = append(s.shutdownHandlers, shutdownHandler{fn: h, timeout: timeout})
+	}
 }
 
 // AddJob adds a function to be run at startup as an asynchronous task or as
@@ -120,19 +190,26 @@ func AddShutdownHandler(handlers ...JobFn) {
 // but exit with code 0, assuming success. As long as at least one function is
 // outstanding and no jobs have failed, the service will continue to run.
 func AddJob(jobs ...JobFn) {
-	srvMu.Lock()
-	defer srvMu.Unlock()
-	srvJobs = append(srvJobs, jobs...)
+	std.addJob(log.Up(1), jobs)
+}
+
+// AddJob adds jobs to the service. See [AddJob].
+func (s *Service) AddJob(jobs ...JobFn) {
+	s.addJob(log.Up(1), jobs)
+}
+
+func (s *Service) addJob(caller log.CodeLocation, jobs []JobFn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range jobs {
+		s.addJobEntry(caller, s.newJobEntry(job, caller))
+	}
 }
 
 // AddJobFn is the [Fn] version of [AddJob].
 // Allows an edditional argument for injecting dependencies and such.
 func AddJobFn[T any](fn func(context.Context, *Logger, T) error, arg T) {
-	srvMu.Lock()
-	defer srvMu.Unlock()
-	srvJobs = append(srvJobs, func(ctx context.Context, logger *Logger) error {
-		return fn(ctx, logger, arg)
-	})
+	std.addJob(log.Up(1), []JobFn{Fn(fn, arg)})
 }
 
 // Fn creates a JobFn from a function that takes a context and a [*Logger]
@@ -153,49 +230,34 @@ func Fn[T any](fn func(context.Context, *Logger, T) error, arg T) JobFn {
 }
 
 // Fatal logs a structured message at the error level with the root logger and
-// exits the program immediately.
+// exits the program immediately with [ExitFailure].
 //
 // NOTE: This bypasses any graceful shutdown handling,  so its use outside of
 // main() is highly discouraged.
 func Fatal(msg string, attrs ...any) {
 	caller := log.Up(1)
-	sFatal(caller, msg, attrs...)
+	std.fatalCode(caller, ExitFailure, msg, attrs...)
 }
 
 // Fatalf logs a formatted message at the error level with the root logger and
-// exits the program immediately.
+// exits the program immediately with [ExitFailure].
 //
 // NOTE: This bypasses any graceful shutdown handling,  so its use outside of
 // main() is highly discouraged.
 func Fatalf(format string, args ...any) {
 	caller := log.Up(1)
-	sFatal(caller, fmt.Sprintf(format, args...))
-	os.Exit(1)
-}
-
-func initCtx() {
-	srvCtx, srvCancel = context.WithCancel(context.Background())
-	// set up a basic logger for before we can set the user's logging handler.
+	std.fatalCode(caller, ExitFailure, fmt.Sprintf(format, args...))
 }
 
 func init() {
-	termlogErr := initTermLog()
-	initCtx()
-	srvlogger.Store(log.NewLogger(slog.New(inithandler.New())))
-	config, err := initConfig()
-	if err != nil {
-		sFatal(noloc, err.Error())
-	}
-	if config.flags != nil {
-		srvFlags = config.flags
-	}
-	initMetrics()
-	if config.pushURL != "" {
-		srvPushURL = config.pushURL
-	}
-	initLogging(config)
-	initHealth()
+	std = newService(true)
+	// the termination log belongs to the process, so only the default service
+	// opens it. It is opened before anything else, so that configuration
+	// errors can be written to it.
+	config, err := parseConfig(os.Args[1:])
+	termlogErr := initTermLog(config.terminationLog)
+	std.init(config, err)
 	if termlogErr != nil {
-		sWarn(noloc, "could not open termination log", termlogErr, "termlog_path", termlogPath)
+		sWarn(noloc, "could not open termination log", termlogErr, "termlog_path", config.terminationLog)
 	}
 }
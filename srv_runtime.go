@@ -1,198 +1,562 @@
 package srv
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
-	"os/signal"
+	rtpprof "runtime/pprof"
+	"time"
 
+	srverrors "andy.dev/srv/errors"
+	"andy.dev/srv/internal/auth"
+	"andy.dev/srv/internal/sdnotify"
+	"andy.dev/srv/internal/tlsreload"
 	"andy.dev/srv/internal/ui"
 	"andy.dev/srv/log"
 	"github.com/alexedwards/flow"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/push"
-	"golang.org/x/sync/errgroup"
 )
 
-const (
-	servicePort = ":8081"
-)
+type shutdownHandler struct {
+	fn      JobFn
+	timeout time.Duration
+}
 
-var (
-	srvHTTP             *http.Server
-	srvJobs             []JobFn
-	srvJobErrs          chan error
-	srvShutdownHandlers []JobFn
-)
+func (s *Service) serve() error {
+	s.emit(Event{Type: EventServing})
+	s.mu.Lock()
+	components, err := componentOrder(s.components)
+	s.mu.Unlock()
+	if err != nil {
+		s.termLogErr(noloc, "invalid component dependencies", err)
+		s.emit(Event{Type: EventExiting, Reason: "invalid component dependencies", Err: err, ExitCode: ExitConfig})
+		return &ExitError{Code: ExitConfig, Err: err}
+	}
 
-func serve(serviceInfo ServiceInfo) {
 	mux := flow.New()
 
-	metricHandler := promhttp.HandlerFor(srvRegistry, promhttp.HandlerOpts{
+	metricHandler := promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{
 		ErrorLog: &promhttpLogger{
-			srvLogger().With("logger", "metrics"),
+			s.rootLogger().With("logger", "metrics"),
 		},
 		ErrorHandling:     promhttp.ContinueOnError,
 		EnableOpenMetrics: true,
 	})
 	mux.Handle("/metrics", metricHandler)
-	if srvPushURL != "" {
-		srvPusher = push.New(srvPushURL, srvInfo.Name).Gatherer(srvRegistry)
+	if s.config.pushURL != "" {
+		s.pusher = push.New(s.config.pushURL, s.serviceInfo.Name).Gatherer(s.registry)
+	}
+
+	// mutating and pprof routes require credentials, if any are configured.
+	authn, err := s.newAuthenticator()
+	if err != nil {
+		s.termLogErr(noloc, "failed to set up instrumentation authentication", err)
+		s.emit(Event{Type: EventExiting, Reason: "failed to set up instrumentation authentication", Err: err, ExitCode: ExitConfig})
+		return &ExitError{Code: ExitConfig, Err: err}
 	}
 
 	// add pprof routes
 	mux.Handle("/debug/pprof", http.RedirectHandler("/debug/pprof/", http.StatusSeeOther))
-	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	mux.HandleFunc("/debug/pprof/...", pprof.Index)
+	mux.Handle("/debug/pprof/cmdline", authn.Wrap(auth.Protected, http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", authn.Wrap(auth.Protected, http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", authn.Wrap(auth.Protected, http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", authn.Wrap(auth.Protected, http.HandlerFunc(pprof.Trace)))
+	mux.Handle("/debug/pprof/...", authn.Wrap(auth.Protected, http.HandlerFunc(pprof.Index)))
 
 	// logger routes
-	mux.HandleFunc("/loggers/level/:logger", srvLevelHandler.RouteLevel, "GET", "POST")
-	mux.HandleFunc("/loggers/level", srvLevelHandler.RouteLevel, "GET", "POST")
-	mux.HandleFunc("/loggers/list", srvLevelHandler.RouteList, "GET")
-	srvLevelHandler.SetLogger(srvLogger())
+	mux.Handle("/loggers/level/:logger", authn.Wrap(auth.ProtectMutating, http.HandlerFunc(s.levelHandler.RouteLevel)), "GET", "POST")
+	mux.Handle("/loggers/level", authn.Wrap(auth.ProtectMutating, http.HandlerFunc(s.levelHandler.RouteLevel)), "GET", "POST")
+	mux.HandleFunc("/loggers/list", s.levelHandler.RouteList, "GET")
+	s.levelHandler.SetLogger(s.rootLogger())
 
-	mux.Handle("/livez", srvHealth, "GET")
-	srvHealth.Start(srvLogger())
+	mux.HandleFunc("/jobs", s.jobsRoute, "GET")
+	mux.HandleFunc("/lifecycle", s.lifecycleRoute, "GET")
+	mux.Handle("/lifecycle/drain", authn.Wrap(auth.Protected, http.HandlerFunc(s.drainRoute)), "POST")
+
+	mux.Handle("/livez", s.health, "GET")
+	mux.Handle("/livez/:check/run", authn.Wrap(auth.Protected, http.HandlerFunc(s.health.Run)), "POST")
+	mux.Handle("/readyz", s.readiness, "GET")
+	mux.Handle("/readyz/:check/run", authn.Wrap(auth.Protected, http.HandlerFunc(s.readiness.Run)), "POST")
+	mux.Handle("/startupz", s.startup, "GET")
 
 	// web UI at root
 	mux.Handle("/...", ui.RootHandler(ui.TmplData{
-		ServiceName: fmt.Sprintf("%s v%s", serviceInfo.Name, serviceInfo.Version),
+		ServiceName: fmt.Sprintf("%s v%s", s.serviceInfo.Name, s.serviceInfo.Version),
 		BuildData:   getBuildData().String(),
 	}))
 
-	srvHTTP = &http.Server{
-		Addr:     servicePort,
+	s.http = &http.Server{
 		Handler:  mux,
-		ErrorLog: srvLogger().With("logger", "instrumentation_http").StdLogger(log.StdLogStatic(LevelError)),
+		ErrorLog: s.rootLogger().With("logger", "instrumentation_http").StdLogger(log.StdLogStatic(LevelError)),
 		BaseContext: func(net.Listener) context.Context {
-			return srvCtx
+			return s.ctx
 		},
 	}
+	serverErrs, err := s.serveInstrumentation()
+	if err != nil {
+		s.termLogErr(noloc, "failed to start instrumentation server", err)
+		s.emit(Event{Type: EventExiting, Reason: "failed to start instrumentation server", Err: err, ExitCode: ExitFailure})
+		return &ExitError{Code: ExitFailure, Err: err}
+	}
+	defer s.http.Close()
 
-	go func() {
-		if err := srvHTTP.ListenAndServe(); err != nil {
-			sFatal(log.NoLocation, "failed to serve routes", "err", err)
-		}
-	}()
+	// notify systemd of our state, if it started us with Type=notify.
+	s.notifier = sdnotify.FromEnv()
 
-	// Set up signal monitoring to stop us if signaled. Rather than using
-	// signal.NotifyContext, which would merely cancel a context, we use the
-	// manual method so that we can handle it twice if necessary (i.e. if the
-	// user is hands-on-keyboard testing and doesn't want to wait for the
-	// shutdown to complete). Because signal delivery is NON-blocking, we need
-	// enough buffer to account for both of these signals, hence the channel
-	// depth of 2.
-	signals := make(chan os.Signal, 2)
-	signal.Notify(signals, os.Interrupt)
-
-	srvJobErrs = make(chan error)
-	// begin running any jobs
-	if len(srvJobs) > 0 {
-		eg, egctx := errgroup.WithContext(srvCtx)
-		for i := range srvJobs {
-			job := srvJobs[i]
-			eg.Go(func() error {
-				// TODO named loggers for jobs hereish
-				return job(egctx, srvLogger())
-			})
-		}
-		go func() {
-			srvJobErrs <- eg.Wait()
-		}()
+	// Set up signal monitoring to stop us if signaled.
+	signals, stopSignals := s.notifySignals()
+	defer stopSignals()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	// start components in dependency order, then begin running any jobs. A
+	// shutdown signal received while they start interrupts them.
+	startCtx, started := s.interruptStart(signals, stopped)
+	err = s.startComponents(startCtx, components)
+	if sig := started(); sig != nil || err != nil {
+		reason := "component failed to start"
+		switch {
+		case sig != nil:
+			reason, err = "received signal "+sig.String(), nil
+		case s.ctx.Err() != nil:
+			reason, err = "service context cancelled", nil
+		}
+		s.emit(Event{Type: EventShuttingDown, Reason: reason, Err: err})
+		s.sdNotify(sdnotify.Stopping, sdnotify.Status("shutting down: "+reason))
+		s.cancel()
+		return s.shutdown(err)
 	}
+	// checks are run straight away, so they may depend on components.
+	s.health.Start(s.rootLogger())
+	s.readiness.Start(s.rootLogger())
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		s.startJob(j)
+	}
+	s.jobsStarted = true
+	s.mu.Unlock()
+	// if a previous process is handing over to us, don't report ready until it
+	// has stopped doing so.
+	if ready, handover := claimHandover(); ready != nil {
+		s.readiness.Hold()
+		go s.takeOver(ready, handover)
+	}
+	s.startup.SetStarted()
+	s.readiness.SetStarted()
+	s.emit(Event{Type: EventReady})
+	s.sdNotify(sdnotify.Ready, sdnotify.Status(s.healthStatus()))
+	stopWatchdog := s.startWatchdog()
+	defer stopWatchdog()
 
 	// Wait for death with a calm stoicism.
-	shutdownWatcher(signals, srvJobErrs, len(srvJobs))
+	cause := s.shutdownWatcher(signals, serverErrs, stopped)
+	return s.shutdown(cause)
+}
+
+type jobResult struct {
+	name string
+	err  error
+}
+
+// startJob runs a job, counting it as outstanding until its result has been
+// received by the shutdown watcher, and as running until it returns.
+// must be called with s.mu held.
+func (s *Service) startJob(j *jobEntry) {
+	s.runningJobs++
+	s.jobsRunning.Add(1)
+	go func() {
+		err := j.run(s.ctx, s.rootLogger(), s.metrics)
+		s.jobsRunning.Done()
+		select {
+		case s.jobResults <- jobResult{j.name, err}:
+		case <-s.ctx.Done():
+			// the watcher is no longer counting
+		}
+	}()
 }
 
-func shutdownWatcher(signals <-chan os.Signal, jobErrs <-chan error, numJobs int) {
+// shutdownWatcher waits for a reason to shut down, returning the error which
+// caused it, if any. If it was a signal, a second one forces an exit until
+// stopped is closed.
+func (s *Service) shutdownWatcher(signals <-chan os.Signal, serverErrs <-chan error, stopped <-chan struct{}) error {
+	var (
+		cause      error
+		reason     string
+		draining   <-chan struct{} = s.draining
+		drainTimer <-chan time.Time
+		upgraded   = make(chan func())
+		handover   func()
+	)
 EVENTS:
 	for {
 		select {
-		case err := <-jobErrs:
-			if err != nil {
-				sError(log.NoLocation, "job failed, shutting down", err)
+		case res := <-s.jobResults:
+			s.mu.Lock()
+			s.runningJobs--
+			remaining := s.runningJobs
+			s.mu.Unlock()
+			if res.err != nil {
+				s.termLogErr(log.NoLocation, "job failed, shutting down", res.err, "job", res.name)
+				cause = fmt.Errorf("job %s failed: %w", res.name, res.err)
+				reason = "job failed"
 				break EVENTS
 			}
-			numJobs--
-			if numJobs == 0 {
-				sInfo(log.NoLocation, "all jobs complete, shutting down")
+			if remaining == 0 {
+				s.logInfo(log.NoLocation, "all jobs complete, shutting down")
+				reason = "all jobs complete"
 				break EVENTS
 			}
-		case <-signals:
-			sInfo(log.NoLocation, "received shutdown signal")
-			// relinquish signal handling
-			signal.Reset(os.Interrupt)
+		case err := <-serverErrs:
+			s.termLogErr(log.NoLocation, "instrumentation server failed, shutting down", err)
+			cause = err
+			reason = "instrumentation server failed"
+			break EVENTS
+		case sig := <-signals:
+			if s.isForceSignal(sig) {
+				s.forceExit(sig)
+			}
+			if s.isDrainSignal(sig) {
+				s.logInfo(log.NoLocation, "received drain signal", "signal", sig.String())
+				s.Drain()
+				continue
+			}
+			if s.isUpgradeSignal(sig) {
+				if draining == nil {
+					s.logWarn(log.NoLocation, "ignoring upgrade signal while draining", "signal", sig.String())
+					continue
+				}
+				s.startUpgrade(upgraded)
+				continue
+			}
+			s.logInfo(log.NoLocation, "received shutdown signal", "signal", sig.String())
+			reason = "received signal " + sig.String()
 			// handle a second signal
-			go func() {
-				<-signals
-				sInfo(noloc, "forced shutdown")
-				os.Exit(130) // manual ctrl-c exitcode
-			}()
+			go s.forceOnSignal(signals, stopped)
+			if draining != nil {
+				// not yet draining, so give load balancers time to notice.
+				s.readiness.Stop()
+				s.shutdownDelay()
+			}
 			break EVENTS
-		case <-srvCtx.Done():
-			sInfo(log.NoLocation, "service is shutting down")
+		case handover = <-upgraded:
+			s.logInfo(log.NoLocation, "upgrade complete, shutting down")
+			reason = "upgraded to new process"
+			break EVENTS
+		case <-draining:
+			s.logInfo(log.NoLocation, "draining", "drain_period", s.config.drainPeriod)
+			s.readiness.SetDraining()
+			s.emit(Event{Type: EventDraining})
+			draining = nil
+			drainTimer = time.After(s.config.drainPeriod)
+		case <-drainTimer:
+			s.logInfo(log.NoLocation, "drain period complete, shutting down")
+			reason = "drain period complete"
+			break EVENTS
+		case <-s.ctx.Done():
+			s.logInfo(log.NoLocation, "service is shutting down")
+			reason = "service context cancelled"
 			break EVENTS
 		}
 	}
-	srvCancel()
-	shutdown()
+	// no more jobs may start once the shutdown is under way, even before the
+	// shutdown handlers run.
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+	s.emit(Event{Type: EventShuttingDown, Reason: reason, Err: cause})
+	s.readiness.Stop()
+	if handover != nil {
+		// we are no longer ready, so the new process can be. This also hands
+		// systemd over to it, so it won't see us stopping.
+		handover()
+	}
+	s.sdNotify(sdnotify.Stopping, sdnotify.Status("shutting down: "+reason))
+	s.cancel()
+	return cause
 }
 
-func shutdown() {
-	normal := true
+// interruptStart handles signals while components are starting, returning a
+// context for starting them which is cancelled by a shutdown signal. Calling
+// started stops the handling, and returns the signal which cancelled the
+// context, if any. After such a signal, a second one forces an exit until
+// stopped is closed.
+func (s *Service) interruptStart(signals <-chan os.Signal, stopped <-chan struct{}) (context.Context, func() os.Signal) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	interrupted := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case sig := <-signals:
+				switch {
+				case s.isForceSignal(sig):
+					s.forceExit(sig)
+				case s.isDrainSignal(sig):
+					s.logInfo(log.NoLocation, "received drain signal", "signal", sig.String())
+					s.Drain()
+				case s.isUpgradeSignal(sig):
+					s.logWarn(log.NoLocation, "ignoring upgrade signal while starting", "signal", sig.String())
+				default:
+					s.logInfo(log.NoLocation, "received shutdown signal while starting", "signal", sig.String())
+					interrupted <- sig
+					cancel()
+					s.forceOnSignal(signals, stopped)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ctx, func() os.Signal {
+		close(done)
+		defer cancel()
+		select {
+		case sig := <-interrupted:
+			return sig
+		case <-exited:
+			return nil
+		}
+	}
+}
 
-	numHandlers := len(srvShutdownHandlers)
-	if len(srvShutdownHandlers) > 0 {
-		sInfo(log.NoLocation, "running shutdown handlers", "num_handlers", numHandlers)
+// forceOnSignal forces an exit on any further shutdown signal, until stopped is
+// closed.
+func (s *Service) forceOnSignal(signals <-chan os.Signal, stopped <-chan struct{}) {
+	for {
+		select {
+		case sig := <-signals:
+			switch {
+			case s.isDrainSignal(sig):
+			case s.isUpgradeSignal(sig):
+				s.logWarn(log.NoLocation, "ignoring upgrade signal while shutting down", "signal", sig.String())
+			default:
+				s.forceExit(sig)
+			}
+		case <-stopped:
+			return
+		}
+	}
+}
+
+// serveInstrumentation starts the instrumentation server on the address set
+// with --instrumentation-addr, using TLS if a certificate has been provided.
+// Any error from the running server is sent on the returned channel.
+func (s *Service) serveInstrumentation() (<-chan error, error) {
+	addr := s.config.instrumentation
+	if addr == "" {
+		addr = defaultInstrumentationAddr
+	}
+	if addr == instrumentationDisabled {
+		s.logInfo(noloc, "instrumentation server disabled")
+		return nil, nil
+	}
+	ln, err := s.listener(noloc, instrumentationListener, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	useTLS := s.config.tlsCertFile != ""
+	if useTLS {
+		reloader, err := tlsreload.New(s.config.tlsCertFile, s.config.tlsKeyFile, s.rootLogger().With("logger", "instrumentation_tls"))
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to load instrumentation TLS certificate: %w", err)
+		}
+		s.http.TLSConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+	s.logInfo(noloc, "serving instrumentation", "addr", ln.Addr().String(), "tls", useTLS)
+	serverErrs := make(chan error, 1)
+	go func() {
+		var err error
+		if useTLS {
+			err = s.http.ServeTLS(ln, "", "")
+		} else {
+			err = s.http.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErrs <- fmt.Errorf("failed to serve routes: %w", err)
+		}
+	}()
+	return serverErrs, nil
+}
+
+// shutdownDelay waits for the duration set with --shutdown-delay before jobs
+// are cancelled, giving load balancers time to stop sending traffic.
+func (s *Service) shutdownDelay() {
+	if s.config.shutdownDelay <= 0 {
+		return
+	}
+	s.logInfo(noloc, "delaying shutdown", "shutdown_delay", s.config.shutdownDelay)
+	t := time.NewTimer(s.config.shutdownDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-s.ctx.Done():
+	}
+}
+
+// shutdown runs the shutdown handlers and returns the exit status of the
+// service, given the error which caused it to shut down, if any.
+func (s *Service) shutdown(cause error) error {
+	var failure error
+
+	ctx := context.Background()
+	if s.config.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.shutdownTimeout)
+		defer cancel()
+	}
+
+	s.mu.Lock()
+	s.stopping = true
+	handlers := s.shutdownHandlers
+	s.mu.Unlock()
+	numHandlers := len(handlers)
+	if numHandlers > 0 {
+		s.logInfo(log.NoLocation, "running shutdown handlers", "num_handlers", numHandlers)
 	}
 
 	didPanic := false
-	for i, sh := range srvShutdownHandlers {
+	for i, sh := range handlers {
 		var err error
+		handler := fmt.Sprintf("handler %d of %d", i+1, numHandlers)
 		if didPanic {
-			sWarn(noloc, "skipping handler due to previous panic")
+			s.logWarn(noloc, "skipping handler due to previous panic")
+			s.emit(Event{Type: EventShutdownHandler, Reason: handler + " skipped due to previous panic"})
 			continue
 		}
-		sDebug(noloc, "running shutdown handler", "handler_number", i+1)
-		// TODO: add timeout
-		didPanic, err = runShutdownHandler(context.Background(), sh)
+		s.logDebug(noloc, "running shutdown handler", "handler_number", i+1)
+		didPanic, err = s.runShutdownHandler(ctx, sh)
+		if ctx.Err() != nil {
+			s.emit(Event{Type: EventShutdownHandler, Reason: handler + " timed out", Err: err})
+			return s.shutdownTimedOut()
+		}
 		if err != nil {
-			sTermLogErr(noloc, "shutdown handler failed", err, "handler_number", i+1, "total_handlers", numHandlers)
-			normal = false
+			s.termLogErr(noloc, "shutdown handler failed", err, "handler_number", i+1, "total_handlers", numHandlers)
+			failure = err
 		}
+		s.emit(Event{Type: EventShutdownHandler, Reason: handler, Err: err})
 	}
 
-	if srvPusher != nil {
-		if err := srvPusher.Add(); err != nil {
-			sTermLogErr(noloc, "failed to push to pushgateway", err)
-			normal = false
+	// components may be in use by jobs until they have returned.
+	if err := s.waitJobs(ctx); err != nil {
+		return s.shutdownTimedOut()
+	}
+	if err := s.stopComponents(ctx); err != nil {
+		if ctx.Err() != nil {
+			return s.shutdownTimedOut()
 		}
+		failure = err
 	}
 
-	if normal {
+	if s.pusher != nil {
+		err := s.pusher.AddContext(ctx)
+		if ctx.Err() != nil {
+			return s.shutdownTimedOut()
+		}
+		if err != nil {
+			s.termLogErr(noloc, "failed to push to pushgateway", err)
+			failure = err
+		}
+	}
+
+	if cause == nil && failure == nil {
 		termlogWrite(noloc, "SHUTDOWN - OK")
-		defer os.Exit(0)
-	} else {
-		termlogWrite(noloc, "SHUTDOWN - NOT OK")
-		defer os.Exit(1)
+		s.emit(Event{Type: EventExiting, ExitCode: ExitOK})
+		return nil
+	}
+	// the reason for shutting down takes precedence over any failure during
+	// shutdown.
+	code := exitStatus(cause)
+	if cause == nil {
+		code = ExitShutdownHandler
+		if hasExitCode(failure) {
+			code = exitStatus(failure)
+		}
 	}
-	termlogClose()
+	termlogWrite(noloc, "SHUTDOWN - NOT OK", "exit_code", code)
+	err := errors.Join(cause, failure)
+	s.emit(Event{Type: EventExiting, Err: err, ExitCode: code})
+	return &ExitError{Code: code, Err: err}
 }
 
-// TODO: add timeouts
-func runShutdownHandler(ctx context.Context, handler JobFn) (panicked bool, err error) {
-	defer func() {
-		if v := recover(); v != nil {
-			panicked = true
-			err = fmt.Errorf("handler panicked %v", v)
-		}
+// shutdownTimedOut is called when the shutdown deadline has expired. It writes
+// a dump of all goroutines to the termination log, to help identify what was
+// holding up shutdown.
+func (s *Service) shutdownTimedOut() error {
+	var dump bytes.Buffer
+	rtpprof.Lookup("goroutine").WriteTo(&dump, 2)
+	s.logError(noloc, "shutdown timed out, exiting", "shutdown_timeout", s.config.shutdownTimeout)
+	termlogWrite(noloc, "SHUTDOWN - TIMED OUT", "shutdown_timeout", s.config.shutdownTimeout, "goroutines", dump.String())
+	err := fmt.Errorf("shutdown timed out after %s", s.config.shutdownTimeout)
+	s.emit(Event{Type: EventExiting, Reason: "shutdown timed out", Err: err, ExitCode: ExitShutdownTimeout})
+	return &ExitError{Code: ExitShutdownTimeout, Err: err}
+}
+
+// waitJobs waits for any jobs which are still running to return, or for ctx to
+// be done.
+func (s *Service) waitJobs(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.jobsRunning.Wait()
+		close(done)
 	}()
-	return false, handler(ctx, srvLogger())
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.logWarn(noloc, "jobs still running at shutdown deadline")
+		return ctx.Err()
+	}
+}
+
+// runShutdownHandler runs a single shutdown handler, returning early if it
+// exceeds either its own timeout or the overall shutdown deadline.
+func (s *Service) runShutdownHandler(ctx context.Context, handler shutdownHandler) (panicked bool, err error) {
+	if handler.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handler.timeout)
+		defer cancel()
+	}
+	return runBounded(ctx, handler.fn, s.rootLogger())
+}
+
+// runBounded runs fn, returning early if ctx is done before it returns. The
+// function itself is left running in this case, since there is no way to stop
+// it.
+func runBounded(ctx context.Context, fn JobFn, logger *Logger) (panicked bool, err error) {
+	type result struct {
+		panicked bool
+		err      error
+	}
+	res := make(chan result, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				res <- result{true, srverrors.Recovered(v)}
+			}
+		}()
+		res <- result{false, fn(ctx, logger)}
+	}()
+	select {
+	case r := <-res:
+		return r.panicked, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return false, fmt.Errorf("timed out")
+		}
+		return false, ctx.Err()
+	}
 }
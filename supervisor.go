@@ -0,0 +1,165 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"andy.dev/srv/log"
+)
+
+const (
+	defaultMaxRestarts   = 5
+	defaultRestartWindow = 5 * time.Minute
+	defaultMinBackoff    = 1 * time.Second
+	defaultMaxBackoff    = 1 * time.Minute
+	defaultJitter        = 0.2
+)
+
+// RestartOption configures how a supervised job is restarted. See
+// [AddSupervisedJob].
+type RestartOption func(rp *restartPolicy) error
+
+type restartPolicy struct {
+	maxRestarts int
+	window      time.Duration
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	jitter      float64
+}
+
+// Restart sets the restart budget for a supervised job. The job may be
+// restarted up to maxRestarts times within any span of the given window. If it
+// fails again after the budget has been exhausted, the failure will be treated
+// like that of any other job, and the service will shut down.
+// Default: 5 restarts within 5 minutes.
+func Restart(maxRestarts int, window time.Duration) RestartOption {
+	return func(rp *restartPolicy) error {
+		if maxRestarts <= 0 {
+			return fmt.Errorf("max restarts must be greater than 0")
+		}
+		if window <= 0 {
+			return fmt.Errorf("restart window must be greater than 0")
+		}
+		rp.maxRestarts = maxRestarts
+		rp.window = window
+		return nil
+	}
+}
+
+// Backoff sets the delay before a failed job is restarted. The delay starts at
+// initial and doubles with each restart within the restart window, up to max.
+// Default: 1 second, up to 1 minute.
+func Backoff(initial, max time.Duration) RestartOption {
+	return func(rp *restartPolicy) error {
+		if initial <= 0 {
+			return fmt.Errorf("initial backoff must be greater than 0")
+		}
+		if max < initial {
+			return fmt.Errorf("max backoff must be greater than or equal to initial backoff")
+		}
+		rp.minBackoff = initial
+		rp.maxBackoff = max
+		return nil
+	}
+}
+
+// Jitter sets the amount of random variation applied to the restart backoff,
+// as a fraction of the delay. A value of 0.2 will vary the delay by up to 20%
+// in either direction. Must be between 0 and 1. Default: 0.2
+func Jitter(fraction float64) RestartOption {
+	return func(rp *restartPolicy) error {
+		if fraction < 0 || fraction > 1 {
+			return fmt.Errorf("jitter must be between 0 and 1")
+		}
+		rp.jitter = fraction
+		return nil
+	}
+}
+
+// AddSupervisedJob adds a job like [AddJob], however, if the job returns a
+// non-nil error, it will be restarted after a backoff delay rather than
+// shutting down the service. Only once the restart budget set by [Restart] has
+// been exhausted will the failure cause the service to shut down. A job which
+// returns nil is considered to have completed, and will not be restarted.
+//
+// Restarts and failures are logged and counted in the job_restarts_total and
+// job_failures_total metrics.
+func AddSupervisedJob(job JobFn, options ...RestartOption) {
+	std.addSupervisedJob(log.Up(1), job, options)
+}
+
+// AddSupervisedJob adds a supervised job to the service. See
+// [AddSupervisedJob].
+func (s *Service) AddSupervisedJob(job JobFn, options ...RestartOption) {
+	s.addSupervisedJob(log.Up(1), job, options)
+}
+
+func (s *Service) addSupervisedJob(caller log.CodeLocation, job JobFn, options []RestartOption) {
+	policy := &restartPolicy{
+		maxRestarts: defaultMaxRestarts,
+		window:      defaultRestartWindow,
+		minBackoff:  defaultMinBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		jitter:      defaultJitter,
+	}
+	for _, o := range options {
+		if err := o(policy); err != nil {
+			s.fatal(caller, "bad restart option", err)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.newJobEntry(job, caller)
+	entry.restart = policy
+	s.addJobEntry(caller, entry)
+}
+
+// backoff returns the delay before the next restart, given the number of
+// restarts which have already occurred within the window.
+func (rp *restartPolicy) backoff(restarts int) time.Duration {
+	delay := rp.maxBackoff
+	// comparing before shifting, since the shift itself could overflow.
+	if rp.minBackoff <= rp.maxBackoff>>restarts {
+		delay = rp.minBackoff << restarts
+	}
+	if rp.jitter > 0 {
+		delay += time.Duration(float64(delay) * rp.jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+func (j *jobEntry) supervise(ctx context.Context, logger *Logger, m *srvMetrics) error {
+	var restarts []time.Time
+	for {
+		err := j.call(ctx, logger)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		m.jobFailures.With("job", j.name).Add(1)
+		now := time.Now()
+		restarts = slices.DeleteFunc(restarts, func(t time.Time) bool {
+			return now.Sub(t) > j.restart.window
+		})
+		if len(restarts) >= j.restart.maxRestarts {
+			logger.Error("job failed, restart budget exhausted", err, "job", j.name, "restarts", len(restarts), "restart_window", j.restart.window)
+			return fmt.Errorf("job %s exhausted its restart budget: %w", j.name, err)
+		}
+		delay := j.restart.backoff(len(restarts))
+		restarts = append(restarts, now)
+		logger.Warn("job failed, restarting", err, "job", j.name, "restarts", len(restarts), "max_restarts", j.restart.maxRestarts, "backoff", delay)
+		m.jobRestarts.With("job", j.name).Add(1)
+		j.setState(jobRestarting, err)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+			j.setState(jobRunning, nil)
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+		restarts int
+		want     time.Duration
+	}{
+		{"first restart", time.Second, time.Minute, 0, time.Second},
+		{"doubles", time.Second, time.Minute, 1, 2 * time.Second},
+		{"below max", time.Second, time.Minute, 5, 32 * time.Second},
+		{"capped", time.Second, time.Minute, 6, time.Minute},
+		{"min equals max", time.Second, time.Second, 3, time.Second},
+		{"would overflow", time.Minute, time.Hour, 28, time.Hour},
+		{"would overflow sign", time.Minute, time.Hour, 31, time.Hour},
+		{"shift wider than int64", time.Second, time.Minute, 64, time.Minute},
+		{"many restarts", time.Nanosecond, time.Hour, 1000, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &restartPolicy{minBackoff: tt.min, maxBackoff: tt.max}
+			if got := rp.backoff(tt.restarts); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.restarts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	rp := &restartPolicy{minBackoff: time.Second, maxBackoff: time.Minute, jitter: 0.2}
+	for restarts := 0; restarts < 40; restarts++ {
+		base := (&restartPolicy{minBackoff: rp.minBackoff, maxBackoff: rp.maxBackoff}).backoff(restarts)
+		lo, hi := time.Duration(float64(base)*0.8), time.Duration(float64(base)*1.2)
+		if got := rp.backoff(restarts); got < lo || got > hi {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", restarts, got, lo, hi)
+		}
+	}
+}
+
+func TestRestartBudget(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name      string
+		options   []RestartOption
+		failures  int32
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name:      "recovers within budget",
+			options:   []RestartOption{Restart(3, time.Minute)},
+			failures:  3,
+			wantCalls: 4,
+		},
+		{
+			name:      "budget exhausted",
+			options:   []RestartOption{Restart(2, time.Minute)},
+			failures:  10,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name: "restarts leave the window",
+			// each restart is outside the window by the time of the next
+			// failure, so the budget of one is never used up.
+			options:   []RestartOption{Restart(1, 10*time.Millisecond), Backoff(20*time.Millisecond, 20*time.Millisecond)},
+			failures:  4,
+			wantCalls: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			var calls atomic.Int32
+			options := append([]RestartOption{Backoff(time.Millisecond, time.Millisecond), Jitter(0)}, tt.options...)
+			s.AddSupervisedJob(func(context.Context, *Logger) error {
+				if calls.Add(1) <= tt.failures {
+					return errFailed
+				}
+				return nil
+			}, options...)
+			err := s.Run(context.Background())
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("job called %d times, want %d", got, tt.wantCalls)
+			}
+			switch {
+			case tt.wantErr && !errors.Is(err, errFailed):
+				t.Errorf("Run() = %v, want %v", err, errFailed)
+			case !tt.wantErr && err != nil:
+				t.Errorf("Run() = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package srv
+
+import (
+	"strings"
+	"time"
+
+	"andy.dev/srv/internal/sdnotify"
+)
+
+// statusInterval is how often the status reported to systemd is updated when
+// the watchdog is not enabled.
+const statusInterval = 10 * time.Second
+
+// sdNotify sends states to systemd, if the service was started by systemd with
+// Type=notify.
+func (s *Service) sdNotify(states ...string) {
+	if s.handedOver.Load() {
+		// systemd is watching the new process now.
+		return
+	}
+	if err := s.notifier.Notify(states...); err != nil {
+		s.logWarn(noloc, "failed to notify systemd", err)
+	}
+}
+
+// healthStatus summarizes the health of the service for systemd.
+func (s *Service) healthStatus() string {
+	if failing := s.health.Failing(); len(failing) > 0 {
+		return "unhealthy, failing checks: " + strings.Join(failing, ", ")
+	}
+	if degraded := s.health.Degraded(); len(degraded) > 0 {
+		return "degraded, failing non-critical checks: " + strings.Join(degraded, ", ")
+	}
+	return "healthy"
+}
+
+// startWatchdog keeps systemd updated with the health of the service, and
+// sends watchdog keep-alives for as long as the service is healthy, so that
+// systemd will restart it if it becomes wedged. It returns a function which
+// stops it.
+func (s *Service) startWatchdog() (stop func()) {
+	if s.notifier == nil {
+		return func() {}
+	}
+	watchdog := sdnotify.WatchdogInterval()
+	interval := statusInterval
+	if watchdog > 0 {
+		// ping at half the deadline, as systemd recommends.
+		interval = watchdog / 2
+		s.logDebug(noloc, "systemd watchdog enabled", "watchdog_interval", watchdog)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		lastStatus := s.healthStatus()
+		for {
+			select {
+			case <-t.C:
+			case <-done:
+				return
+			}
+			var states []string
+			status := s.healthStatus()
+			if status != lastStatus {
+				states = append(states, sdnotify.Status(status))
+				lastStatus = status
+			}
+			// an unhealthy service stops pinging, and will be restarted.
+			if watchdog > 0 && len(s.health.Failing()) == 0 {
+				states = append(states, sdnotify.Watchdog)
+			}
+			s.sdNotify(states...)
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -1,37 +1,65 @@
 package srv
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"log/slog"
 	"os"
 	"sync"
+	"unicode/utf8"
 
 	"andy.dev/srv/log"
 )
 
 const (
-	// termlogPath = `/dev/termination-log`
-	termlogPath = `./termlog`
+	// defaultTermlogPath is where Kubernetes expects the termination log by
+	// default.
+	defaultTermlogPath = `/dev/termination-log`
+	// termlogDisabled is the --termination-log value which disables the
+	// termination log.
+	termlogDisabled = "none"
+	// termlogMaxSize is the most Kubernetes will read from a termination log.
+	termlogMaxSize   = 4096
+	termlogTruncated = "...[truncated]\n"
+	// termlogReserved is kept free when the termination log can only be
+	// appended to, for the entries written last.
+	termlogReserved = 1024
 )
 
 var (
-	srvTermlogfile *os.File
-	srvTermlog     *log.Logger
-	muTermlog      sync.Mutex
+	srvTermlogw *termlogWriter
+	srvTermlog  *log.Logger
+	muTermlog   sync.Mutex
 )
 
-func initTermLog() error {
+// defaultTermlog returns the default termination log path, which is only set
+// when running in a container.
+func defaultTermlog() string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return defaultTermlogPath
+	}
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return defaultTermlogPath
+		}
+	}
+	return ""
+}
+
+// initTermLog opens the termination log at path, creating it if necessary. An
+// empty path disables the termination log.
+func initTermLog(path string) error {
 	muTermlog.Lock()
 	defer muTermlog.Unlock()
-	tl, err := os.OpenFile(termlogPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if path == "" || path == termlogDisabled {
+		return nil
+	}
+	tl, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
-		}
 		return err
 	}
-	srvTermlog = log.NewLogger(slog.New(slog.NewTextHandler(tl, &slog.HandlerOptions{
+	srvTermlogw = &termlogWriter{f: tl}
+	srvTermlog = log.NewLogger(slog.New(slog.NewTextHandler(srvTermlogw, &slog.HandlerOptions{
 		AddSource: true,
 		Level:     slog.LevelDebug,
 		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
@@ -50,13 +78,92 @@ func initTermLog() error {
 	return nil
 }
 
+// termlogWriter keeps the termination log within termlogMaxSize. Rather than
+// cutting off whatever comes last, it drops the oldest entries, so that the
+// final message, which explains why the service exited, is kept intact.
+//
+// A file which can't be truncated, such as a pipe, can only be appended to.
+// Entries are written to it until all but termlogReserved bytes are used, and
+// later ones are held back until Close, which writes the newest of them in the
+// space left.
+type termlogWriter struct {
+	f       *os.File
+	entries [][]byte
+	// appended counts the bytes written to a file which can't be truncated,
+	// and held counts the newest entries not yet written to it.
+	appended int
+	held     int
+}
+
+// Write is called by the log handler once per entry.
+func (w *termlogWriter) Write(p []byte) (int, error) {
+	w.entries = newestEntries(append(w.entries, bytes.Clone(p)), termlogMaxSize)
+	if err := w.f.Truncate(0); err != nil {
+		// not a regular file, so append while there's room to spare.
+		entry := w.entries[len(w.entries)-1]
+		if w.held > 0 || w.appended+len(entry) > termlogMaxSize-termlogReserved {
+			w.held++
+			return len(p), nil
+		}
+		n, err := w.f.Write(entry)
+		w.appended += n
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if _, err := w.f.WriteAt(bytes.Join(w.entries, nil), 0); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the entries held back from a file which can't be truncated,
+// and closes it.
+func (w *termlogWriter) Close() error {
+	if w.held > 0 {
+		held := w.entries[len(w.entries)-min(w.held, len(w.entries)):]
+		w.held = 0
+		if _, err := w.f.Write(bytes.Join(newestEntries(held, termlogMaxSize-w.appended), nil)); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	return w.f.Close()
+}
+
+// newestEntries drops the oldest entries until the rest fit in limit bytes. If
+// the newest entry doesn't fit on its own, as much of it as possible is kept,
+// since its message comes first.
+func newestEntries(entries [][]byte, limit int) [][]byte {
+	size, keep := 0, len(entries)
+	for keep > 0 && size+len(entries[keep-1]) <= limit {
+		size += len(entries[keep-1])
+		keep--
+	}
+	if keep == len(entries) {
+		return [][]byte{truncateEntry(entries[keep-1], limit)}
+	}
+	return entries[keep:]
+}
+
+// truncateEntry shortens an entry to fit in limit bytes, without splitting a
+// multi-byte character.
+func truncateEntry(p []byte, limit int) []byte {
+	n := limit - len(termlogTruncated)
+	for n > 0 && !utf8.RuneStart(p[n]) {
+		n--
+	}
+	return append(bytes.Clone(p[:n]), termlogTruncated...)
+}
+
 func termlogClose() {
 	muTermlog.Lock()
 	defer muTermlog.Unlock()
-	if srvTermlogfile != nil {
-		srvTermlogfile.Close()
+	if srvTermlogw != nil {
+		srvTermlogw.Close()
 	}
-	srvTermlogfile = nil
+	srvTermlogw = nil
 	srvTermlog = nil
 }
 
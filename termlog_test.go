@@ -0,0 +1,147 @@
+package srv
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func termlogEntry(c byte, size int) []byte {
+	return append(bytes.Repeat([]byte{c}, size-1), '\n')
+}
+
+func openTermlog(t *testing.T) (*termlogWriter, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "termination-log")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return &termlogWriter{f: f}, path
+}
+
+func writeTermlog(t *testing.T, w io.Writer, p []byte) {
+	t.Helper()
+	n, err := w.Write(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(p) {
+		t.Fatalf("wrote %d bytes, want %d", n, len(p))
+	}
+}
+
+func readTermlog(t *testing.T, path string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > termlogMaxSize {
+		t.Errorf("termination log is %d bytes, more than %d", len(b), termlogMaxSize)
+	}
+	return b
+}
+
+func TestTermlogEvictsOldest(t *testing.T) {
+	w, path := openTermlog(t)
+	var entries [][]byte
+	for c := byte('a'); c <= 'f'; c++ {
+		e := termlogEntry(c, 1000)
+		entries = append(entries, e)
+		writeTermlog(t, w, e)
+	}
+	// only the newest four fit.
+	want := bytes.Join(entries[2:], nil)
+	if got := readTermlog(t, path); !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes starting %q, want %d bytes starting %q", len(got), got[:1], len(want), want[:1])
+	}
+}
+
+func TestTermlogTruncatesOversizedEntry(t *testing.T) {
+	w, path := openTermlog(t)
+	writeTermlog(t, w, termlogEntry('a', 100))
+	// with a one byte prefix, each two-byte rune starts at an odd offset, so
+	// the cut would otherwise land in the middle of one.
+	big := []byte("x" + strings.Repeat("é", termlogMaxSize) + "\n")
+	writeTermlog(t, w, big)
+
+	got := readTermlog(t, path)
+	if !bytes.HasPrefix(got, []byte("xé")) {
+		t.Errorf("termination log starts %q, want the oversized entry", got[:min(len(got), 10)])
+	}
+	if !bytes.HasSuffix(got, []byte(termlogTruncated)) {
+		t.Errorf("termination log doesn't end with %q", termlogTruncated)
+	}
+	if !utf8.Valid(got) {
+		t.Error("termination log is not valid UTF-8")
+	}
+
+	// the truncated entry is evicted by the next one, rather than cut again.
+	next := termlogEntry('b', 100)
+	writeTermlog(t, w, next)
+	if got := readTermlog(t, path); !bytes.Equal(got, next) {
+		t.Errorf("got %q, want %q", got, next)
+	}
+}
+
+func TestTermlogAppendsWithinLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		last []byte
+		want func(entries [][]byte) []byte
+	}{
+		{
+			// a pipe can't be truncated, so the oldest are kept, with room
+			// left for the newest.
+			name: "newest fits",
+			last: termlogEntry('f', 1000),
+			want: func(entries [][]byte) []byte {
+				return bytes.Join(append(entries[:3:3], entries[5]), nil)
+			},
+		},
+		{
+			name: "newest truncated",
+			last: termlogEntry('f', 2000),
+			want: func(entries [][]byte) []byte {
+				return bytes.Join(append(entries[:3:3], truncateEntry(entries[5], termlogMaxSize-3000)), nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pr.Close()
+			w := &termlogWriter{f: pw}
+			var entries [][]byte
+			for c := byte('a'); c <= 'e'; c++ {
+				entries = append(entries, termlogEntry(c, 1000))
+			}
+			entries = append(entries, tt.last)
+			for _, e := range entries {
+				writeTermlog(t, w, e)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(pr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) > termlogMaxSize {
+				t.Errorf("termination log is %d bytes, more than %d", len(got), termlogMaxSize)
+			}
+			if want := tt.want(entries); !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes ending %q, want %d bytes ending %q", len(got), got[len(got)-20:], len(want), want[len(want)-20:])
+			}
+		})
+	}
+}
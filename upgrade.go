@@ -0,0 +1,294 @@
+package srv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"andy.dev/srv/internal/sdnotify"
+	"andy.dev/srv/log"
+)
+
+const (
+	// upgradeFDEnv holds the first of the two file descriptors used by a
+	// parent process to hand over to its replacement. The first is written to
+	// by the new process once it is ready, and the second is closed by the
+	// parent once it has stopped reporting ready.
+	upgradeFDEnv = "SRV_UPGRADE_FD"
+	upgradeReady = "READY\n"
+	// handoverPollInterval is how often a new process checks whether it has
+	// become ready.
+	handoverPollInterval = 100 * time.Millisecond
+)
+
+// the handover files passed by a parent process belong to the process, so
+// they may only be claimed once.
+var upgradeClaimed bool
+
+// UpgradeSignals sets the signals which will upgrade the service in place. On
+// receiving one, the service starts a new copy of its executable, which may
+// have been replaced since it started, and passes it all listeners returned by
+// [Listener], along with the instrumentation server's. Once the new process is
+// ready, the old one stops reporting ready and shuts down normally, and the
+// new process begins reporting ready in its place. If the new process does not
+// become ready within --upgrade-timeout, or exits, it is killed and the old
+// process keeps running. Only one upgrade may be in progress at a time.
+// Default: SIGUSR2
+func UpgradeSignals(signals ...os.Signal) {
+	std.setSignals(log.Up(1), &std.upgradeSignals, signals)
+}
+
+// UpgradeSignals sets the signals which upgrade the service in place. See
+// [UpgradeSignals]. Since an upgrade replaces the whole process, services
+// created with [New] have no upgrade signals by default.
+func (s *Service) UpgradeSignals(signals ...os.Signal) {
+	s.setSignals(log.Up(1), &s.upgradeSignals, signals)
+}
+
+// startUpgrade begins an upgrade in the background, unless one is already in
+// progress. If the new process becomes ready, a function which completes the
+// handover is sent on upgraded. The watcher must call this function once it
+// has stopped reporting ready.
+func (s *Service) startUpgrade(upgraded chan<- func()) {
+	if !s.upgrading.CompareAndSwap(false, true) {
+		s.logWarn(noloc, "upgrade already in progress")
+		return
+	}
+	s.logInfo(noloc, "upgrading")
+	go func() {
+		cmd, handover, err := s.upgrade()
+		if err != nil {
+			s.logError(noloc, "upgrade failed", err)
+			s.upgrading.Store(false)
+			return
+		}
+		select {
+		case upgraded <- handover:
+		case <-s.ctx.Done():
+			// shutting down for some other reason, so the new process isn't
+			// wanted.
+			s.logWarn(noloc, "service shut down during upgrade, stopping new process", "pid", cmd.Process.Pid)
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}()
+}
+
+// upgrade starts a new process, passing it our listeners, and waits for it to
+// become ready. It returns a function which tells the new process that it can
+// begin reporting ready.
+func (s *Service) upgrade() (*exec.Cmd, func(), error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find executable: %w", err)
+	}
+	files, names, err := s.listenerFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	handoverR, handoverW, err := os.Pipe()
+	if err != nil {
+		readyR.Close()
+		readyW.Close()
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyW, handoverR)
+	cmd.Env = append(upgradeEnv(),
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		upgradeFDEnv+"="+strconv.Itoa(3+len(files)),
+	)
+	err = cmd.Start()
+	// the new process has its own copies.
+	readyW.Close()
+	handoverR.Close()
+	if err != nil {
+		readyR.Close()
+		handoverW.Close()
+		return nil, nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+	pid := cmd.Process.Pid
+	s.logInfo(noloc, "started new process, waiting for it to become ready", "pid", pid)
+
+	if err := s.waitReady(readyR); err != nil {
+		readyR.Close()
+		handoverW.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, nil, fmt.Errorf("new process %d failed to become ready: %w", pid, err)
+	}
+	s.logInfo(noloc, "new process is ready", "pid", pid)
+	return cmd, func() {
+		s.mu.Lock()
+		for _, l := range s.listeners {
+			// the new process is using the socket file now.
+			if ul, ok := l.ln.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(false)
+			}
+		}
+		s.mu.Unlock()
+		s.sdNotify(sdnotify.MainPID(pid))
+		s.handedOver.Store(true)
+		readyR.Close()
+		handoverW.Close()
+	}, nil
+}
+
+// waitReady waits for a new process to write that it is ready. The new
+// process closing its end first means that it has exited, or failed to start
+// serving.
+func (s *Service) waitReady(ready *os.File) error {
+	ctx := s.ctx
+	if s.config.upgradeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.upgradeTimeout)
+		defer cancel()
+	}
+	res := make(chan error, 1)
+	go func() {
+		msg, err := bufio.NewReader(ready).ReadString('\n')
+		switch {
+		case msg == upgradeReady:
+			res <- nil
+		case err == io.EOF:
+			res <- fmt.Errorf("exited before it was ready")
+		case err != nil:
+			res <- err
+		default:
+			res <- fmt.Errorf("unexpected message %q", msg)
+		}
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		// unblocks the read
+		ready.Close()
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", s.config.upgradeTimeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// listenerFiles returns copies of the file descriptors of the service's
+// listeners, along with any inherited listeners which were never used, and
+// their names.
+func (s *Service) listenerFiles() ([]*os.File, []string, error) {
+	type filer interface {
+		File() (*os.File, error)
+	}
+	s.mu.Lock()
+	listeners := append([]namedListener(nil), s.listeners...)
+	s.mu.Unlock()
+	muInherited.Lock()
+	for _, l := range inherited {
+		listeners = append(listeners, namedListener{l.Name, l.Listener})
+	}
+	muInherited.Unlock()
+
+	var (
+		files []*os.File
+		names []string
+	)
+	for _, l := range listeners {
+		fl, ok := l.ln.(filer)
+		if !ok {
+			s.logWarn(noloc, "listener cannot be passed to new process", "listener", l.name)
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to get file for listener %s: %w", l.name, err)
+		}
+		files = append(files, f)
+		names = append(names, l.name)
+	}
+	return files, names, nil
+}
+
+// upgradeEnv returns the environment of the new process, without any
+// variables describing files passed to this one. $WATCHDOG_PID is removed as
+// well, so that the new process takes over the watchdog.
+func upgradeEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		switch k {
+		case "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", "WATCHDOG_PID", upgradeFDEnv:
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// claimHandover returns the files passed by a parent process which is handing
+// over to this one, or nil if there are none.
+func claimHandover() (ready, handover *os.File) {
+	muInherited.Lock()
+	defer muInherited.Unlock()
+	if upgradeClaimed {
+		return nil, nil
+	}
+	upgradeClaimed = true
+	fdStr := os.Getenv(upgradeFDEnv)
+	os.Unsetenv(upgradeFDEnv)
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil || fd < 3 {
+		return nil, nil
+	}
+	// not to be passed on to any later upgrade.
+	syscall.CloseOnExec(fd)
+	syscall.CloseOnExec(fd + 1)
+	return os.NewFile(uintptr(fd), "upgrade-ready"), os.NewFile(uintptr(fd+1), "upgrade-handover")
+}
+
+// takeOver tells the parent process that we are ready once our readiness
+// checks pass, then waits for it to stop reporting ready before we begin to.
+func (s *Service) takeOver(ready, handover *os.File) {
+	defer ready.Close()
+	defer handover.Close()
+	// if anything goes wrong, the parent will have stopped waiting for us.
+	defer s.readiness.Release()
+	t := time.NewTicker(handoverPollInterval)
+	defer t.Stop()
+	for !s.readiness.Ready() {
+		select {
+		case <-t.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+	if _, err := ready.Write([]byte(upgradeReady)); err != nil {
+		s.logError(noloc, "failed to notify previous process", err)
+		return
+	}
+	// the parent closes its end once it has stopped reporting ready, or when
+	// it exits.
+	io.Copy(io.Discard, handover)
+	s.logInfo(noloc, "took over from previous process")
+}